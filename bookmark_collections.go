@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const TableNameBookmarkCollections = "bookmark_collections"
+
+var dbcBookmarkCollections *mgo.Collection
+
+func init() {
+	const tableName = TableNameBookmarkCollections
+	dbcBookmarkCollections = dbSession.DB(dbName).C(tableName)
+	dbCols[tableName] = dbcBookmarkCollections
+
+	index := mgo.Index{
+		Key:        []string{"userid", "name"},
+		Unique:     true,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+}
+
+const MaxBookmarkCollectionNameLength = 30
+
+// BookmarkCollection is a named group of bookmarks of a user.
+type BookmarkCollection struct {
+	Id      bson.ObjectId `bson:"_id" json:"id"`
+	UserId  bson.ObjectId `json:"-"`
+	Name    string        `json:"name"`
+	Count   int           `bson:"count" json:"count"` // Number of bookmarks in it
+	Updated time.Time     `json:"updated"`
+	Created time.Time     `json:"created"`
+}
+
+////////////////////////      BASIC OPERATIONS     ///////////////////////////
+
+func (i *BookmarkCollection) Insert() (bson.ObjectId, error) {
+	if i.Id.Valid() == false {
+		i.Id = bson.NewObjectId()
+	}
+
+	i.Created = time.Now()
+	i.Updated = i.Created
+
+	if err := dbcBookmarkCollections.Insert(&i); err != nil {
+		log.Println("Could not insert a bookmark collection.")
+		return i.Id, err
+	}
+
+	return i.Id, nil
+}
+
+func (i *BookmarkCollection) Update() (err error) {
+	if i.Id.Valid() == false {
+		return errors.New("Invalid BookmarkCollection Id")
+	}
+
+	i.Updated = time.Now()
+	return dbcBookmarkCollections.UpdateId(i.Id, bson.M{"$set": bson.M{"name": i.Name, "updated": i.Updated}})
+}
+
+// Delete removes the collection. Its bookmarks are kept out of any collection.
+func (i *BookmarkCollection) Delete() (err error) {
+	if i.Id.Valid() == false {
+		return errors.New("Invalid BookmarkCollection Id")
+	}
+
+	if _, err = dbcBookmarks.UpdateAll(
+		bson.M{"collectionid": i.Id},
+		bson.M{"$unset": bson.M{"collectionid": ""}},
+	); err != nil {
+		return
+	}
+
+	return dbcBookmarkCollections.RemoveId(i.Id)
+}
+
+func (i *BookmarkCollection) GetById(id bson.ObjectId) error {
+	if err := dbcBookmarkCollections.FindId(id).One(&i); err != nil {
+		log.Println("Could not find BookmarkCollectionById.")
+		return err
+	}
+
+	return nil
+}
+
+// incBookmarkCollectionCount changes count of the collection if id is valid.
+func incBookmarkCollectionCount(id bson.ObjectId, n int) {
+	if id.Valid() == false {
+		return
+	}
+
+	if err := dbcBookmarkCollections.UpdateId(id, bson.M{"$inc": bson.M{"count": n}}); err != nil {
+		log.Print(err)
+	}
+}
+
+// getMyBookmarkCollection finds collection id of the user. Responds on its own
+// when not found.
+func getMyBookmarkCollection(gc *gin.Context, id bson.ObjectId, userId bson.ObjectId) (collection BookmarkCollection, ok bool) {
+	if err := collection.GetById(id); err != nil {
+		DataNotFound(gc)
+		return collection, false
+	}
+
+	if collection.UserId != userId {
+		NotAuthorized(gc)
+		return collection, false
+	}
+
+	return collection, true
+}
+
+func validBookmarkCollectionName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > MaxBookmarkCollectionNameLength {
+		return name, errors.New("Invalid name.")
+	}
+	return name, nil
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+func getMyBookmarkCollections(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	var collections []BookmarkCollection
+	if err := dbcBookmarkCollections.Find(bson.M{"userid": myAccount.Id}).Sort("name").All(&collections); err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(collections)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully fetched Collections.",
+		"collections": collections,
+	})
+}
+
+func insertBookmarkCollection(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	var posted BookmarkCollection
+	if err := gc.BindJSON(&posted); err != nil {
+		log.Println(err)
+		ErrorBinding(gc)
+		return
+	}
+
+	name, err := validBookmarkCollectionName(posted.Name)
+	if err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	collection := BookmarkCollection{
+		UserId: myAccount.Id,
+		Name:   name,
+	}
+
+	if _, err := collection.Insert(); mgo.IsDup(err) {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Collection name already exists."})
+		return
+
+	} else if err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Created collection.", "collection": collection})
+}
+
+func updateBookmarkCollection(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	collection, ok := getMyBookmarkCollection(gc, id, myAccount.Id)
+	if ok == false {
+		return
+	}
+
+	var posted BookmarkCollection
+	if err := gc.BindJSON(&posted); err != nil {
+		log.Println(err)
+		ErrorBinding(gc)
+		return
+	}
+
+	if collection.Name, err = validBookmarkCollectionName(posted.Name); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	if err := collection.Update(); mgo.IsDup(err) {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Collection name already exists."})
+		return
+
+	} else if err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Updated collection.", "collection": collection})
+}
+
+func deleteBookmarkCollection(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	collection, ok := getMyBookmarkCollection(gc, id, myAccount.Id)
+	if ok == false {
+		return
+	}
+
+	if err := collection.Delete(); err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Removed collection."})
+}
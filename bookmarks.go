@@ -0,0 +1,380 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const TableNameBookmarks = "bookmarks"
+
+var dbcBookmarks *mgo.Collection
+
+func init() {
+	const tableName = TableNameBookmarks
+	dbcBookmarks = dbSession.DB(dbName).C(tableName)
+	dbCols[tableName] = dbcBookmarks
+
+	index := mgo.Index{
+		Key:        []string{"userid", "category", "relatedid"},
+		Unique:     true,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	index = mgo.Index{
+		Key:        []string{"userid", "-created"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+}
+
+// bookmarkCategory returns the collection of documents in category that can
+// be bookmarked. Each document keeps the number of its bookmarks in
+// "bookmarkcount".
+func bookmarkCategory(category string) (*mgo.Collection, bool) {
+	switch category {
+	case "review":
+		return dbcReviews, true
+	case "hospital":
+		return dbcHospitals, true
+	}
+	return nil, false
+}
+
+// Bookmark of a review or hospital saved by a user. A bookmark is in one
+// collection or in none.
+type Bookmark struct {
+	Id           bson.ObjectId `bson:"_id" json:"id"`
+	UserId       bson.ObjectId `json:"-"`
+	Category     string        `json:"category"`
+	RelatedId    bson.ObjectId `json:"relatedid"`
+	CollectionId bson.ObjectId `bson:",omitempty" json:"collectionid,omitempty"`
+	Review       *Review       `bson:"-" json:"review,omitempty"`
+	Hospital     *Hospital     `bson:"-" json:"hospital,omitempty"`
+	Created      time.Time     `json:"created"`
+}
+
+////////////////////////      BASIC OPERATIONS     ///////////////////////////
+
+// Insert saves the bookmark and counts it on the bookmarked document.
+func (i *Bookmark) Insert() (bson.ObjectId, error) {
+	col, ok := bookmarkCategory(i.Category)
+	if ok == false {
+		return i.Id, errors.New("Unknown category.")
+	}
+
+	if i.Id.Valid() == false {
+		i.Id = bson.NewObjectId()
+	}
+	i.Created = time.Now()
+
+	if err := dbcBookmarks.Insert(&i); err != nil {
+		log.Println("Could not insert a bookmark.")
+		return i.Id, err
+	}
+
+	if err := col.UpdateId(i.RelatedId, bson.M{"$inc": bson.M{"bookmarkcount": 1}}); err != nil {
+		log.Print(err)
+	}
+	incBookmarkCollectionCount(i.CollectionId, 1)
+
+	return i.Id, nil
+}
+
+// MoveTo moves the bookmark to collectionId. Invalid id takes it out of its
+// collection.
+func (i *Bookmark) MoveTo(collectionId bson.ObjectId) (err error) {
+	if collectionId == i.CollectionId {
+		return nil
+	}
+
+	if collectionId.Valid() {
+		err = dbcBookmarks.UpdateId(i.Id, bson.M{"$set": bson.M{"collectionid": collectionId}})
+	} else {
+		err = dbcBookmarks.UpdateId(i.Id, bson.M{"$unset": bson.M{"collectionid": ""}})
+	}
+	if err != nil {
+		return
+	}
+
+	incBookmarkCollectionCount(i.CollectionId, -1)
+	incBookmarkCollectionCount(collectionId, 1)
+	i.CollectionId = collectionId
+	return nil
+}
+
+func (i *Bookmark) Delete() (err error) {
+	if i.Id.Valid() == false {
+		return errors.New("Invalid Bookmark Id")
+	}
+
+	if err = dbcBookmarks.RemoveId(i.Id); err != nil {
+		return
+	}
+
+	if col, ok := bookmarkCategory(i.Category); ok {
+		if err := col.UpdateId(i.RelatedId, bson.M{"$inc": bson.M{"bookmarkcount": -1}}); err != nil {
+			log.Print(err)
+		}
+	}
+	incBookmarkCollectionCount(i.CollectionId, -1)
+
+	return nil
+}
+
+// Find finds the bookmark of UserId on Category and RelatedId.
+func (i *Bookmark) Find() error {
+	return dbcBookmarks.Find(bson.M{
+		"userid":    i.UserId,
+		"category":  i.Category,
+		"relatedid": i.RelatedId,
+	}).One(&i)
+}
+
+// loadBookmarked sets Review or Hospital of bookmarks. Bookmarks of removed
+// documents are left out.
+func loadBookmarked(bookmarks []Bookmark, userId bson.ObjectId) []Bookmark {
+	var reviewIds, hospitalIds []bson.ObjectId
+	for _, bookmark := range bookmarks {
+		if bookmark.Category == "review" {
+			reviewIds = append(reviewIds, bookmark.RelatedId)
+		} else if bookmark.Category == "hospital" {
+			hospitalIds = append(hospitalIds, bookmark.RelatedId)
+		}
+	}
+
+	reviews := make(map[bson.ObjectId]*Review)
+	if len(reviewIds) > 0 {
+		var found []Review
+		if err := dbcReviews.Find(bson.M{
+			"_id":         bson.M{"$in": reviewIds},
+			"isdraft":     false,
+			"isdeleted":   false,
+			"issuspended": false,
+			"ispending":   bson.M{"$ne": true},
+		}).All(&found); err != nil {
+			log.Print(err)
+		}
+		for n := range found {
+			found[n].SetViewer(userId)
+			reviews[found[n].Id] = &found[n]
+		}
+	}
+
+	hospitals := make(map[bson.ObjectId]*Hospital)
+	if len(hospitalIds) > 0 {
+		var found []Hospital
+		if err := dbcHospitals.Find(bson.M{"_id": bson.M{"$in": hospitalIds}}).All(&found); err != nil {
+			log.Print(err)
+		}
+		setHospitalsOpenStatus(found, time.Now())
+		for n := range found {
+			found[n].SetLiked(userId)
+			hospitals[found[n].Id] = &found[n]
+		}
+	}
+
+	loaded := make([]Bookmark, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		bookmark.Review = reviews[bookmark.RelatedId]
+		bookmark.Hospital = hospitals[bookmark.RelatedId]
+		if bookmark.Review != nil || bookmark.Hospital != nil {
+			loaded = append(loaded, bookmark)
+		}
+	}
+	return loaded
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+// getMyBookmarks lists bookmarks with the bookmarked documents.
+//
+//	category       review or hospital
+//	collectionid   Bookmarks in the collection. "none" for not in any.
+func getMyBookmarks(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	query := bson.M{"userid": myAccount.Id}
+
+	if category := gc.Query("category"); category != "" {
+		if _, ok := bookmarkCategory(category); ok == false {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Unknown category."})
+			return
+		}
+		query["category"] = category
+	}
+
+	if str := gc.Query("collectionid"); str == "none" {
+		query["collectionid"] = bson.M{"$exists": false}
+	} else if str != "" {
+		if bson.IsObjectIdHex(str) == false {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid collectionid."})
+			return
+		}
+		query["collectionid"] = bson.ObjectIdHex(str)
+	}
+
+	page, err := getPageFromQuery(gc, DefaultPageLimit, SortKeyCreated, true)
+	if err != nil {
+		return
+	}
+
+	var bookmarks []Bookmark
+	if err := dbcBookmarks.Find(page.Query(query)).Sort(page.Sort()...).Limit(page.QueryLimit()).All(&bookmarks); err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	hasMore := page.HasMore(len(bookmarks))
+	nextCursor := ""
+	if hasMore {
+		bookmarks = bookmarks[:page.Limit]
+		last := bookmarks[len(bookmarks)-1]
+		nextCursor = NewCursor(last.Created, last.Id).Encode()
+	}
+
+	bookmarks = loadBookmarked(bookmarks, myAccount.Id)
+
+	log.Println("Fetched " + strconv.Itoa(len(bookmarks)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully fetched My Bookmarks.",
+		"bookmarks":   bookmarks,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
+}
+
+// insertBookmark bookmarks a review or hospital. Posting collectionid puts it
+// in the collection. Bookmarking again moves it to the posted collection.
+func insertBookmark(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	category := gc.Param("category")
+	col, ok := bookmarkCategory(category)
+	if ok == false {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Unknown category."})
+		return
+	}
+
+	relatedId, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	if category == "hospital" {
+		relatedId = resolveHospitalId(relatedId)
+	}
+
+	// Reviews hidden to others are not bookmarked.
+	query := bson.M{"_id": relatedId}
+	if category == "review" {
+		query = NewReviewQuery().Filter
+		query["_id"] = relatedId
+	}
+
+	if n, err := col.Find(query).Count(); err != nil || n == 0 {
+		DataNotFound(gc)
+		return
+	}
+
+	var posted struct {
+		CollectionId bson.ObjectId `json:"collectionid,omitempty"`
+	}
+	if gc.Request.ContentLength > 0 {
+		if err := gc.BindJSON(&posted); err != nil {
+			log.Println(err)
+			ErrorBinding(gc)
+			return
+		}
+	}
+
+	if posted.CollectionId.Valid() {
+		if _, ok := getMyBookmarkCollection(gc, posted.CollectionId, myAccount.Id); ok == false {
+			return
+		}
+	}
+
+	bookmark := Bookmark{
+		UserId:       myAccount.Id,
+		Category:     category,
+		RelatedId:    relatedId,
+		CollectionId: posted.CollectionId,
+	}
+
+	if err := bookmark.Find(); err == nil {
+		if err := bookmark.MoveTo(posted.CollectionId); err != nil {
+			log.Println(err)
+			DatabaseError(gc)
+			return
+		}
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Already bookmarked.", "bookmark": bookmark})
+		return
+	}
+
+	if _, err := bookmark.Insert(); err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Bookmarked!", "bookmark": bookmark})
+}
+
+func deleteBookmark(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	relatedId, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	bookmark := Bookmark{
+		UserId:    myAccount.Id,
+		Category:  gc.Param("category"),
+		RelatedId: relatedId,
+	}
+
+	if err := bookmark.Find(); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Not bookmarked."})
+		return
+	}
+
+	if err := bookmark.Delete(); err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Removed bookmark."})
+}
@@ -30,6 +30,11 @@ func init() {
 	if err := dbCols[tableName].EnsureIndex(index); err != nil {
 		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
 	}
+	if err := dbCols[tableName].EnsureIndex(searchTextIndex); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+	}
+
+	backfillLikeCount(dbcComments)
 }
 
 // Comment for reviews
@@ -37,12 +42,16 @@ type Comment struct {
 	Id             bson.ObjectId   `bson:"_id" json:"id"`
 	Category       string          `json:"-"` // Comment for a doc in which Collection
 	RelatedId      bson.ObjectId   `json:"-"` // Comment for which document
-	UserId         bson.ObjectId   `json:"userid"`
+	UserId         bson.ObjectId   `json:"userid,omitempty"`
 	Nickname       string          `json:"nickname"`
+	IsAnonymous    bool            `bson:"isanonymous" json:"isanonymous"` // Author is hidden to others
 	CommentBody    string          `json:"commentbody"`
 	ReplyTo        bson.ObjectId   `bson:",omitempty" json:"replyto_commentid"`
 	UsersMentioned []bson.ObjectId `bson:",omitempty" json:"users_mentioned"`
-	Likes          []bson.ObjectId `bson:",omitempty" json:"likes"`
+	Likes          []bson.ObjectId `bson:",omitempty" json:"-"`
+	LikeCount      int             `bson:"likecount" json:"like_count"`
+	Liked          bool            `bson:"-" json:"liked"` // Liked by who requested
+	SearchTerms    string          `bson:"searchterms" json:"-"`
 	Created        time.Time       `json:"created"`
 }
 
@@ -57,6 +66,8 @@ func (i *Comment) Insert() (bson.ObjectId, error) {
 		i.Created = time.Now()
 	}
 
+	i.SearchTerms = i.searchTerms()
+
 	err := dbcComments.Insert(&i)
 	if err != nil {
 		log.Println("Could not insert a comment.")
@@ -69,12 +80,14 @@ func (i *Comment) Insert() (bson.ObjectId, error) {
 	return i.Id, nil
 }
 
-func (i *Comment) Update() (changeInfo *mgo.ChangeInfo, err error) {
+// Update saves the body of the comment, leaving likes as they are in DB.
+func (i *Comment) Update() (err error) {
 	if i.Id.Valid() == false {
 		err = errors.New("Invalid Comment Id")
 		return
 	}
-	changeInfo, err = dbcComments.UpsertId(i.Id, &i)
+	i.SearchTerms = i.searchTerms()
+	err = setFields(dbcComments, i.Id, i, "commentbody", "searchterms")
 	return
 }
 
@@ -87,6 +100,10 @@ func (i *Comment) Delete() (err error) {
 	return
 }
 
+func (i *Comment) searchTerms() string {
+	return searchTerms(i.CommentBody)
+}
+
 func (i *Comment) GetById(id bson.ObjectId) error {
 	if err := dbcComments.FindId(id).One(&i); err != nil {
 		log.Println("Could not find CommentById.")
@@ -96,10 +113,47 @@ func (i *Comment) GetById(id bson.ObjectId) error {
 	return nil
 }
 
+func (i *Comment) Like(userId bson.ObjectId) (alreadyLiked bool, err error) {
+	alreadyLiked, i.LikeCount, err = addLike(dbcComments, i.Id, userId)
+	if err != nil {
+		log.Println("Erro while liking comment.")
+		return false, err
+	}
+
+	i.Liked = true
+	return alreadyLiked, nil
+}
+
+func (i *Comment) Unlike(userId bson.ObjectId) (notLiked bool, err error) {
+	notLiked, i.LikeCount, err = removeLike(dbcComments, i.Id, userId)
+	if err != nil {
+		log.Println("Erro while unliking comment.")
+		return false, err
+	}
+
+	i.Liked = false
+	return notLiked, nil
+}
+
+// SetViewer prepares the comment for the user who requested it. It sets Liked
+// and hides the author of an anonymous comment from others.
+func (i *Comment) SetViewer(userId bson.ObjectId) {
+	i.Liked = isLikedBy(i.Likes, userId)
+
+	if i.IsAnonymous && i.UserId != userId {
+		i.UserId = ""
+		i.Nickname = AnonymousNickname
+	}
+}
+
 /////////////////////////    CONTROLLERS    ////////////////////////
 
+var commentSortKeys = map[string]SortKey{
+	"created": SortKeyCreated,
+}
+
 func getComments(gc *gin.Context) {
-	isLoggedIn, _ := isLoggedIn(gc)
+	isLoggedIn, myAccount := isLoggedIn(gc)
 	if isLoggedIn == false {
 		return
 	}
@@ -121,27 +175,22 @@ func getComments(gc *gin.Context) {
 	}
 
 	sort := gc.DefaultQuery("sort", "created")
-	skipStr := gc.DefaultQuery("skip", "0")
-	limitStr := gc.DefaultQuery("limit", "20")
-
-	skip, err := strconv.Atoi(skipStr)
+	key, desc, err := parseSort(sort, commentSortKeys)
 	if err != nil {
-		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid Skip."})
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid sort."})
 		return
 	}
 
-	limit, err := strconv.Atoi(limitStr)
+	page, err := getPageFromQuery(gc, DefaultPageLimit, key, desc)
 	if err != nil {
-		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid limit."})
 		return
 	}
 
-	// TODO Check if sort is valid
-
-	log.Printf("skip: %d, limit: %d, sort: %s.", skip, limit, sort)
+	log.Printf("limit: %d, sort: %s.", page.Limit, sort)
 
 	var comments []Comment
-	if err := dbcComments.Find(bson.M{"relatedid": review.Id}).Sort(sort).Skip(skip).Limit(limit).All(&comments); err != nil {
+	query := page.Query(bson.M{"relatedid": review.Id})
+	if err := dbcComments.Find(query).Sort(page.Sort()...).Limit(page.QueryLimit()).All(&comments); err != nil {
 		log.Print(err)
 		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error while retrieving data from DB."})
 		return
@@ -149,15 +198,29 @@ func getComments(gc *gin.Context) {
 
 	if len(comments) == 0 {
 		log.Print("No Comments")
-		gc.JSON(http.StatusOK, gin.H{"status": -2, "message": "No comments."})
+		gc.JSON(http.StatusOK, gin.H{"status": -2, "message": "No comments.", "has_more": false})
 		return
 	}
 
+	hasMore := page.HasMore(len(comments))
+	nextCursor := ""
+	if hasMore {
+		comments = comments[:page.Limit]
+		last := comments[len(comments)-1]
+		nextCursor = NewCursor(last.Created, last.Id).Encode()
+	}
+
+	for n := range comments {
+		comments[n].SetViewer(myAccount.Id)
+	}
+
 	log.Println("Fetched " + strconv.Itoa(len(comments)) + " rows.")
 	gc.JSON(http.StatusOK, gin.H{
-		"status":   0,
-		"message":  "Successfully fetched Comments.",
-		"comments": comments,
+		"status":      0,
+		"message":     "Successfully fetched Comments.",
+		"comments":    comments,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
 	})
 	return
 }
@@ -214,6 +277,11 @@ func insertComment(gc *gin.Context) {
 	comment.UserId = myAccount.Id
 	comment.Created = time.Now()
 
+	notificationMessage := userData.Nickname
+	if comment.IsAnonymous {
+		notificationMessage = AnonymousNickname
+	}
+
 	// #TODO Limit the number of Comments per user
 
 	if _, err := comment.Insert(); err != nil {
@@ -240,7 +308,7 @@ func insertComment(gc *gin.Context) {
 				Id:          bson.NewObjectId(), // Insert a new Notification
 				UserId:      review.UserId,      // For user who owns the Review
 				Type:        "review_comment",
-				Message:     userData.Nickname,
+				Message:     notificationMessage,
 				RelatedType: "review",
 				RelatedId:   review.Id,
 				IsRead:      false, // It's new and not read.
@@ -298,11 +366,11 @@ func updateComment(gc *gin.Context) {
 	comment.CommentBody = posted.CommentBody
 	// TODO Handle ReplyTo and users_mentioned
 
-	if changeInfo, err := comment.Update(); err != nil {
+	if err := comment.Update(); err != nil {
 		log.Println(err)
 		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Failed update comment."})
 	} else {
-		gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Updated " + strconv.Itoa(changeInfo.Updated) + " field(s)."})
+		gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Updated comment."})
 	}
 	return
 }
@@ -352,23 +420,93 @@ func deleteComment(gc *gin.Context) {
 			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Reveiw does not exist."})
 			return
 		}
-		targetIndex := -1
-		for i, val := range review.Comments {
-			if val == commentId {
-				targetIndex = i
-				break
-			}
-		}
-		if targetIndex == -1 {
-			log.Print("targetIndex -1")
-			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Comment does not exist."})
-			return
-		}
-		review.Comments = append(review.Comments[:targetIndex], review.Comments[targetIndex+1:]...)
-		if _, err := review.Update(); err != nil {
+		if err := review.RemoveComment(commentId); err != nil {
 			log.Print("Review update failed.")
 		}
 		log.Print("Review Comments updated.")
 	}
 	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Removed comment."})
 }
+
+func likeComment(gc *gin.Context) {
+	isLoggedIn, myAccount := isLoggedIn(gc)
+	if isLoggedIn == false {
+		return
+	}
+
+	commentId, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	comment := Comment{}
+	if err := comment.GetById(commentId); err != nil {
+		log.Println(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "No Comment found matching ObjectId."})
+		return
+	}
+
+	if alreadyLiked, err := comment.Like(myAccount.Id); err != nil {
+		log.Println(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error while updating DB!"})
+		return
+
+	} else if alreadyLiked == true {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Your already liked it!", "like_count": comment.LikeCount})
+		return
+	}
+
+	// Do not notify me liking my own comment
+	if comment.UserId != myAccount.Id {
+		var userData UserData
+		if err := userData.GetById(myAccount.Id); err != nil {
+			userData.Nickname = "No nickname"
+		}
+
+		notification := Notification{
+			Id:          bson.NewObjectId(), // Insert a new Notification
+			UserId:      comment.UserId,     // User who owns the Comment and see this notification
+			Type:        "comment_like",
+			Message:     userData.Nickname,
+			RelatedType: comment.Category,
+			RelatedId:   comment.RelatedId,
+			IsRead:      false, // It's new and not read.
+			IsSent:      false,
+		}
+
+		if _, err := notification.Insert(); err != nil {
+			log.Print(err)
+		}
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Liked the comment!", "like_count": comment.LikeCount})
+}
+
+func unlikeComment(gc *gin.Context) {
+	isLoggedIn, myAccount := isLoggedIn(gc)
+	if isLoggedIn == false {
+		return
+	}
+
+	commentId, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	comment := Comment{Id: commentId}
+	if notLiked, err := comment.Unlike(myAccount.Id); err == mgo.ErrNotFound {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "No Comment found matching ObjectId."})
+		return
+
+	} else if err != nil {
+		log.Println(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error while updating DB!"})
+		return
+
+	} else if notLiked == true {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "You have not liked it.", "like_count": comment.LikeCount})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Unliked the comment.", "like_count": comment.LikeCount})
+}
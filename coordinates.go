@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// Public datasets of Korea give coordinates in Transverse Mercator
+// projections of Korean datums. They are converted to WGS84 longitude and
+// latitude as stored in GeoJson.
+
+type ellipsoid struct {
+	a float64 // Semi-major axis in meters
+	f float64 // Flattening
+}
+
+func (e ellipsoid) e2() float64 {
+	return e.f * (2 - e.f)
+}
+
+var (
+	ellipsoidWGS84  = ellipsoid{a: 6378137, f: 1 / 298.257223563}
+	ellipsoidGRS80  = ellipsoid{a: 6378137, f: 1 / 298.257222101}
+	ellipsoidBessel = ellipsoid{a: 6377397.155, f: 1 / 299.1528128}
+)
+
+// tmProjection is a Transverse Mercator projection. Datums other than WGS84
+// are shifted to WGS84 by toWGS84 in meters.
+type tmProjection struct {
+	ellipsoid
+	lat0, lon0 float64 // Origin in degrees
+	k0         float64 // Scale factor
+	fe, fn     float64 // False easting and northing in meters
+	toWGS84    [3]float64
+}
+
+// Projections by EPSG code.
+var tmProjections = map[string]tmProjection{
+	// Korean 1985 / Central Belt. 중부원점 of older datasets.
+	"EPSG:2097": {ellipsoidBessel, 38, 127, 1, 200000, 500000, [3]float64{-146.43, 507.89, 681.46}},
+	// Korean 1985 / Modified Central Belt. 보정된 중부원점.
+	"EPSG:5174": {ellipsoidBessel, 38, 127.0028902777778, 1, 200000, 500000, [3]float64{-115.80, 474.99, 674.11}},
+	// Korea 2000 / Central Belt
+	"EPSG:5181": {ellipsoidGRS80, 38, 127, 1, 200000, 500000, [3]float64{}},
+	// Korea 2000 / Central Belt 2010
+	"EPSG:5186": {ellipsoidGRS80, 38, 127, 1, 200000, 600000, [3]float64{}},
+	// Korea 2000 / Unified CS. UTM-K.
+	"EPSG:5179": {ellipsoidGRS80, 38, 127.5, 0.9996, 1000000, 2000000, [3]float64{}},
+}
+
+func lookupProjection(crs string) (tmProjection, bool) {
+	crs = strings.ToUpper(strings.TrimSpace(crs))
+	// GeoJSON names crs like "urn:ogc:def:crs:EPSG::5174".
+	if n := strings.LastIndex(crs, ":"); strings.HasPrefix(crs, "URN:") && n >= 0 {
+		crs = "EPSG:" + crs[n+1:]
+	}
+	projection, ok := tmProjections[crs]
+	return projection, ok
+}
+
+// meridianArc is the distance in meters from the equator to lat in radians.
+func (e ellipsoid) meridianArc(lat float64) float64 {
+	e2 := e.e2()
+	e4 := e2 * e2
+	e6 := e4 * e2
+	return e.a * ((1-e2/4-3*e4/64-5*e6/256)*lat -
+		(3*e2/8+3*e4/32+45*e6/1024)*math.Sin(2*lat) +
+		(15*e4/256+45*e6/1024)*math.Sin(4*lat) -
+		(35*e6/3072)*math.Sin(6*lat))
+}
+
+// inverse returns longitude and latitude in degrees of x and y on the
+// datum of the projection.
+func (p tmProjection) inverse(x, y float64) (lon, lat float64) {
+	const rad = math.Pi / 180
+	e2 := p.e2()
+	ep2 := e2 / (1 - e2)
+
+	m := p.meridianArc(p.lat0*rad) + (y-p.fn)/p.k0
+	mu := m / (p.a * (1 - e2/4 - 3*e2*e2/64 - 5*e2*e2*e2/256))
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+
+	phi1 := mu + (3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+		(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+		(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+
+	sin, cos, tan := math.Sin(phi1), math.Cos(phi1), math.Tan(phi1)
+	c1 := ep2 * cos * cos
+	t1 := tan * tan
+	n1 := p.a / math.Sqrt(1-e2*sin*sin)
+	r1 := p.a * (1 - e2) / math.Pow(1-e2*sin*sin, 1.5)
+	d := (x - p.fe) / (n1 * p.k0)
+
+	lat = phi1 - (n1*tan/r1)*(d*d/2-
+		(5+3*t1+10*c1-4*c1*c1-9*ep2)*math.Pow(d, 4)/24+
+		(61+90*t1+298*c1+45*t1*t1-252*ep2-3*c1*c1)*math.Pow(d, 6)/720)
+	lon = p.lon0*rad + (d-
+		(1+2*t1+c1)*math.Pow(d, 3)/6+
+		(5-2*c1+28*t1-3*c1*c1+8*ep2+24*t1*t1)*math.Pow(d, 5)/120)/cos
+
+	return lon / rad, lat / rad
+}
+
+// shiftDatum moves lon and lat in degrees on e to WGS84 by shift in meters.
+func shiftDatum(e ellipsoid, shift [3]float64, lon, lat float64) (float64, float64) {
+	if shift == [3]float64{} {
+		return lon, lat
+	}
+
+	const rad = math.Pi / 180
+	phi, lambda := lat*rad, lon*rad
+
+	// To earth centered coordinates and shifted
+	e2 := e.e2()
+	n := e.a / math.Sqrt(1-e2*math.Sin(phi)*math.Sin(phi))
+	x := n*math.Cos(phi)*math.Cos(lambda) + shift[0]
+	y := n*math.Cos(phi)*math.Sin(lambda) + shift[1]
+	z := n*(1-e2)*math.Sin(phi) + shift[2]
+
+	// Back to longitude and latitude on WGS84
+	w := ellipsoidWGS84
+	we2 := w.e2()
+	p := math.Sqrt(x*x + y*y)
+	phi = math.Atan2(z, p*(1-we2))
+	for i := 0; i < 5; i++ {
+		n = w.a / math.Sqrt(1-we2*math.Sin(phi)*math.Sin(phi))
+		phi = math.Atan2(z+we2*n*math.Sin(phi), p)
+	}
+
+	return math.Atan2(y, x) / rad, phi / rad
+}
+
+// toWGS84 converts x and y in crs to WGS84 longitude and latitude.
+// Coordinates in WGS84 or "EPSG:4326" are returned as they are.
+func toWGS84(crs string, x, y float64) (lon, lat float64, err error) {
+	switch strings.ToUpper(crs) {
+	case "", "WGS84", "EPSG:4326", "URN:OGC:DEF:CRS:OGC:1.3:CRS84":
+		return x, y, nil
+	}
+
+	projection, ok := lookupProjection(crs)
+	if ok == false {
+		return 0, 0, errors.New("Unknown coordinate system: " + crs)
+	}
+
+	lon, lat = projection.inverse(x, y)
+	lon, lat = shiftDatum(projection.ellipsoid, projection.toWGS84, lon, lat)
+	return lon, lat, nil
+}
+
+// isInKorea tells if the point is in the bounding box of South Korea.
+func isInKorea(lon, lat float64) bool {
+	return lat >= 33 && lat <= 39 && lon >= 124 && lon <= 132
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestToWGS84(t *testing.T) {
+	tests := []struct {
+		crs      string
+		x, y     float64
+		lon, lat float64
+	}{
+		// Origins of Korea 2000 are exact on GRS80.
+		{"EPSG:5181", 200000, 500000, 127, 38},
+		{"EPSG:5186", 200000, 600000, 127, 38},
+		{"EPSG:5179", 1000000, 2000000, 127.5, 38},
+		// Origin of the modified central belt at 127°0'10.405" on Bessel,
+		// shifted to WGS84 as by PROJ with the same towgs84.
+		{"EPSG:5174", 200000, 500000, 127.00069, 38.00288},
+		{"urn:ogc:def:crs:EPSG::5174", 200000, 500000, 127.00069, 38.00288},
+		{"EPSG:4326", 126.9779, 37.5663, 126.9779, 37.5663},
+	}
+
+	const tolerance = 0.0001 // About 10 meters
+	for _, test := range tests {
+		lon, lat, err := toWGS84(test.crs, test.x, test.y)
+		if err != nil {
+			t.Errorf("%s: %s", test.crs, err.Error())
+			continue
+		}
+		if math.Abs(lon-test.lon) > tolerance || math.Abs(lat-test.lat) > tolerance {
+			t.Errorf("%s: %f %f = %f %f, want %f %f", test.crs, test.x, test.y, lon, lat, test.lon, test.lat)
+		}
+	}
+
+	if _, _, err := toWGS84("EPSG:3857", 0, 0); err == nil {
+		t.Error("EPSG:3857: want an error")
+	}
+}
+
+func TestHeaderCrs(t *testing.T) {
+	tests := map[string]string{
+		"좌표정보x(epsg5174)":   "EPSG:5174",
+		"좌표정보(Y) EPSG:5186": "EPSG:5186",
+		"좌표정보(x)":           "",
+		"x":                 "",
+	}
+
+	for header, want := range tests {
+		if crs := headerCrs(header); crs != want {
+			t.Errorf("headerCrs(%q) = %q, want %q", header, crs, want)
+		}
+	}
+}
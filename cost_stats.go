@@ -0,0 +1,209 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Radius in meters of cost statistics when location is given without distance.
+const costStatsDistance = 5000
+
+const costStatsExpiry = 10 * time.Minute
+
+// Fields cost statistics can be grouped by. Keys are the values accepted in
+// "group_by". Array fields are unwound, so a review counts in each of its
+// categories.
+var costStatsGroups = map[string]string{
+	"category": "categories",
+	"part":     "parts",
+	"pet_type": "pettype",
+	"pet_size": "petsize",
+}
+
+// CostStats summarizes costs of reviews in a group. Costs are in won.
+type CostStats struct {
+	Group   interface{} `json:"group,omitempty"` // Value of the grouped field
+	Count   int         `json:"count"`           // Sample size
+	Min     int         `json:"min"`
+	Median  int         `json:"median"`
+	P90     int         `json:"p90"`
+	Max     int         `json:"max"`
+	Average float64     `json:"average"`
+}
+
+// Groups of cost statistics at most, of the most reviews.
+const maxCostStatsGroups = 50
+
+// percentileRank returns the nearest rank, from 1, of percentile p of count
+// sorted costs.
+func percentileRank(count int, p float64) int {
+	rank := int(math.Ceil(p * float64(count)))
+	if rank < 1 {
+		rank = 1
+	}
+	return rank
+}
+
+// costAtRank returns the cost at rank, from 1, of costs of pipeline in
+// ascending order. Only the costs up to the rank are sorted in memory.
+func costAtRank(pipeline []bson.M, rank int) (int, error) {
+	var result struct {
+		Cost int `bson:"cost"`
+	}
+	err := dbcReviews.Pipe(append(pipeline,
+		bson.M{"$sort": bson.M{"cost": 1}},
+		bson.M{"$skip": rank - 1},
+		bson.M{"$limit": 1},
+		bson.M{"$project": bson.M{"cost": 1}},
+	)).One(&result)
+	return result.Cost, err
+}
+
+// costStats computes statistics of reviews matching query. Without groupField
+// all reviews are in one group. Costs are not loaded, so medians and p90 are
+// found by rank in each group.
+func costStats(query bson.M, groupField string) ([]CostStats, error) {
+	pipeline := []bson.M{{"$match": query}}
+
+	var groupId interface{}
+	if groupField != "" {
+		if groupField == "categories" || groupField == "parts" {
+			pipeline = append(pipeline, bson.M{"$unwind": "$" + groupField})
+		}
+		groupId = "$" + groupField
+	}
+
+	var groups []struct {
+		Id    interface{} `bson:"_id"`
+		Count int         `bson:"count"`
+		Min   int         `bson:"min"`
+		Max   int         `bson:"max"`
+		Sum   int         `bson:"sum"`
+	}
+	if err := dbcReviews.Pipe(append(pipeline,
+		bson.M{"$group": bson.M{
+			"_id":   groupId,
+			"count": bson.M{"$sum": 1},
+			"min":   bson.M{"$min": "$cost"},
+			"max":   bson.M{"$max": "$cost"},
+			"sum":   bson.M{"$sum": "$cost"},
+		}},
+		bson.M{"$sort": bson.M{"count": -1}},
+		bson.M{"$limit": maxCostStatsGroups},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	)).All(&groups); err != nil {
+		return nil, err
+	}
+
+	stats := make([]CostStats, 0, len(groups))
+	for _, group := range groups {
+		if group.Count == 0 {
+			continue
+		}
+
+		inGroup := pipeline
+		if groupField != "" {
+			inGroup = append(pipeline[:len(pipeline):len(pipeline)], bson.M{"$match": bson.M{groupField: group.Id}})
+		}
+
+		median, err := costAtRank(inGroup, percentileRank(group.Count, 0.5))
+		if err != nil {
+			return nil, err
+		}
+		p90, err := costAtRank(inGroup, percentileRank(group.Count, 0.9))
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, CostStats{
+			Group:   group.Id,
+			Count:   group.Count,
+			Min:     group.Min,
+			Median:  median,
+			P90:     p90,
+			Max:     group.Max,
+			Average: float64(group.Sum) / float64(group.Count),
+		})
+	}
+
+	return stats, nil
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+// getCostStats responds with min, median, p90 and max cost of reviews.
+// Filters are the same as of review lists. See ReviewQuery.Parse.
+// Location limits reviews to the circle of distance meters.
+//
+//	group_by   category, part, pet_type or pet_size
+func getCostStats(gc *gin.Context) {
+	loggedIn, _ := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	groupBy := gc.Query("group_by")
+	groupField, ok := costStatsGroups[groupBy]
+	if groupBy != "" && ok == false {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid group_by."})
+		return
+	}
+
+	// Same queries are cached. Encode sorts the keys.
+	cacheKey := "coststats:" + gc.Request.URL.Query().Encode()
+
+	var cached gin.H
+	if getCache(cacheKey, &cached) {
+		gc.JSON(http.StatusOK, cached)
+		return
+	}
+
+	rq := NewReviewQuery()
+	if err := rq.Parse(gc); err != nil {
+		return
+	}
+
+	// Not listed, so location is a radius filter only.
+	rq.Key = SortKeyCreated
+	if rq.Near != nil && rq.Near.Distance <= 0 {
+		rq.Near.Distance = costStatsDistance
+	}
+
+	rq.Range("cost", "$gt", 0)
+
+	stats, err := costStats(rq.Query(), "")
+	if err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	if len(stats) == 0 {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No costs."})
+		return
+	}
+
+	response := gin.H{
+		"status":  0,
+		"message": "Successfully fetched cost statistics.",
+		"stats":   stats[0],
+	}
+
+	if groupField != "" {
+		groups, err := costStats(rq.Query(), groupField)
+		if err != nil {
+			log.Print(err)
+			DatabaseError(gc)
+			return
+		}
+		response["groups"] = groups
+	}
+
+	setCache(cacheKey, response, costStatsExpiry)
+	gc.JSON(http.StatusOK, response)
+}
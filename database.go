@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 // dbSession for MongoDB
@@ -44,6 +45,45 @@ func DropDb() {
 	}
 }
 
+// setFields saves only fields of doc by their names in DB, so that likes,
+// bookmarks and others updated meanwhile by $addToSet or $inc are kept.
+// Fields left out by omitempty are unset.
+func setFields(col *mgo.Collection, id bson.ObjectId, doc interface{}, fields ...string) error {
+	return setFieldsWhere(col, bson.M{"_id": id}, doc, fields...)
+}
+
+// setFieldsWhere is setFields on the document matching selector. Returns
+// mgo.ErrNotFound when none matches.
+func setFieldsWhere(col *mgo.Collection, selector bson.M, doc interface{}, fields ...string) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	values := bson.M{}
+	if err := bson.Unmarshal(raw, &values); err != nil {
+		return err
+	}
+
+	set, unset := bson.M{}, bson.M{}
+	for _, field := range fields {
+		if value, ok := values[field]; ok {
+			set[field] = value
+		} else {
+			unset[field] = ""
+		}
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return col.Update(selector, update)
+}
+
 type Near struct {
 	Coordinate  GeoJson `json:"$geometry"`
 	MaxDistance float64 // in Meters
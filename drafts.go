@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ReviewDraft is posted to autosave a draft. Id is empty for a new draft.
+type ReviewDraft struct {
+	Id    bson.ObjectId `json:"id,omitempty"`
+	PetId bson.ObjectId `json:"petid,omitempty"`
+	ReviewContent
+}
+
+// saveDraft saves the content of the draft and fields. Returns
+// mgo.ErrNotFound when it was published meanwhile, so it is not made a draft
+// again.
+func (i *Review) saveDraft(fields ...string) error {
+	i.SearchTerms = i.searchTerms()
+	i.setRegion()
+	return setFieldsWhere(dbcReviews, bson.M{"_id": i.Id, "isdraft": true}, i,
+		append(reviewContentFields, fields...)...)
+}
+
+// Publish validates the draft and makes it public.
+func (i *Review) Publish() error {
+	pet := Pet{}
+	if err := pet.GetById(i.PetId); err != nil || pet.UserId != i.UserId {
+		return errors.New("Invalid Pet.")
+	}
+
+	content := i.Content()
+	if err := content.Validate(i); err != nil {
+		return err
+	}
+
+	i.PetType = pet.Type
+	i.PetSize = pet.Size
+	i.PetAge = pet.Age
+	i.IsDraft = false
+	// Lists are sorted by created. Published review goes on top.
+	i.Created = time.Now()
+	i.Updated = i.Created
+
+	if err := i.saveContent("pettype", "petsize", "petage", "isdraft", "created",
+		"ispending", "spamscore", "spamreasons", "ip"); err != nil {
+		return err
+	}
+
+	updateHospitalRatings(i.HospitalId)
+	return nil
+}
+
+// CleanupDrafts removes drafts and their images not saved for expiry.
+func CleanupDrafts(expiry time.Duration) {
+	cutoff := time.Now().Add(-expiry)
+
+	var drafts []Review
+	if err := dbcReviews.Find(bson.M{
+		"isdraft": true,
+		"$or": []bson.M{
+			{"updated": bson.M{"$lt": cutoff}},
+			{"updated": bson.M{"$exists": false}, "created": bson.M{"$lt": cutoff}},
+		},
+	}).All(&drafts); err != nil {
+		log.Print(err)
+		return
+	}
+
+	for _, draft := range drafts {
+		var images []Image
+		if err := dbcImages.Find(bson.M{"category": "review", "relatedid": draft.Id}).All(&images); err != nil {
+			log.Print(err)
+			continue
+		}
+
+		for _, image := range images {
+			if err := image.Delete(); err != nil {
+				log.Print(err)
+			}
+		}
+
+		if err := draft.Delete(); err != nil {
+			log.Print(err)
+		}
+	}
+
+	log.Printf("Removed %d abandoned drafts.", len(drafts))
+}
+
+// runDraftCleanup cleans up drafts every hour. Run it as a goroutine.
+func runDraftCleanup() {
+	expiry := time.Duration(*draftExpiryDays) * 24 * time.Hour
+	for {
+		CleanupDrafts(expiry)
+		time.Sleep(time.Hour)
+	}
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+func getMyDrafts(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	page, err := getPageFromQuery(gc, DefaultPageLimit, SortKeyCreated, true)
+	if err != nil {
+		return
+	}
+
+	var reviews []Review
+	query := page.Query(bson.M{
+		"userid":    myAccount.Id,
+		"isdraft":   true,
+		"isdeleted": false,
+	})
+	if err := dbcReviews.Find(query).Sort(page.Sort()...).Limit(page.QueryLimit()).All(&reviews); err != nil {
+		log.Print(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error while retrieving data from DB."})
+		return
+	}
+
+	if len(reviews) == 0 {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No Drafts.", "has_more": false})
+		return
+	}
+
+	reviews, nextCursor, hasMore := pageReviews(reviews, page)
+
+	log.Println("Fetched " + strconv.Itoa(len(reviews)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully fetched My Drafts.",
+		"reviews":     reviews,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
+}
+
+func saveDraft(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	var posted ReviewDraft
+	if err := gc.BindJSON(&posted); err != nil {
+		log.Println(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Parsing posted JSON failed."})
+		return
+	}
+
+	draft := Review{
+		UserId:  myAccount.Id,
+		IsDraft: true,
+	}
+
+	if posted.Id.Valid() {
+		if err := draft.GetById(posted.Id); err != nil || draft.IsDeleted {
+			DataNotFound(gc)
+			return
+		}
+
+		if draft.UserId != myAccount.Id || draft.IsDraft == false {
+			NotAuthorized(gc)
+			return
+		}
+	}
+
+	if posted.PetId.Valid() {
+		pet := Pet{}
+		if err := pet.GetById(posted.PetId); err != nil || pet.UserId != myAccount.Id {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid Pet."})
+			return
+		}
+		draft.PetId = pet.Id
+	}
+
+	// Images are added by uploading. Keep them unless posted.
+	fields := []string{"petid"}
+	if posted.Images == nil {
+		posted.Images = draft.Images
+	} else {
+		fields = append(fields, "images")
+	}
+
+	if err := posted.ValidateImages(&draft); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	if posted.HospitalId != draft.HospitalId {
+		if err := draft.LocateAt(posted.HospitalId); err != nil {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid hospital."})
+			return
+		}
+	}
+
+	draft.SetContent(posted.ReviewContent)
+	draft.Updated = time.Now()
+
+	if draft.Id.Valid() {
+		if err := draft.saveDraft(fields...); err == mgo.ErrNotFound {
+			gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Already published."})
+			return
+		} else if err != nil {
+			log.Println(err)
+			DatabaseError(gc)
+			return
+		}
+	} else {
+		if _, err := draft.Insert(); err != nil {
+			log.Println(err)
+			DatabaseError(gc)
+			return
+		}
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":  0,
+		"message": "Saved draft.",
+		"id":      draft.Id.Hex(),
+		"updated": draft.Updated,
+	})
+}
+
+func publishDraft(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var draft Review
+	if err := draft.GetById(id); err != nil || draft.IsDeleted {
+		DataNotFound(gc)
+		return
+	}
+
+	if draft.UserId != myAccount.Id {
+		NotAuthorized(gc)
+		return
+	}
+
+	if draft.IsDraft == false {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Already published."})
+		return
+	}
+
+	if _, err := draft.CheckSpam(remoteIP(gc)); err == ErrTooManyReviews {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	} else if err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	if err := draft.Publish(); err != nil {
+		log.Println(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	if draft.IsPending == false {
+		go notifyFollowers(draft)
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":  0,
+		"message": "Published review!",
+		"review":  draft,
+	})
+}
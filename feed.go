@@ -0,0 +1,355 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/redis.v3"
+)
+
+// The feed ranks recent reviews by a score summing weighted signals.
+// Reviews served in the personalized feed are remembered in Redis and not
+// served again until feedSeenExpiry passes, so requesting the feed again
+// returns the next reviews.
+const (
+	feedCandidateDays  = 30
+	feedCandidateLimit = 500
+	feedSeenExpiry     = 7 * 24 * time.Hour
+	feedReadExpiry     = 30 * 24 * time.Hour
+
+	// A review loses half of its recency score in feedHalfLife.
+	feedHalfLife = 48 * time.Hour
+	// A review feedNearDistance meters away gets half of proximity score.
+	feedNearDistance = 5000.0
+)
+
+// FeedWeights weights signals of a review's feed score.
+type FeedWeights struct {
+	Recency   float64
+	Likes     float64
+	Comments  float64
+	Proximity float64
+	Pet       float64
+	Category  float64
+	Hospital  float64
+}
+
+var trendingWeights = FeedWeights{
+	Recency:  3,
+	Likes:    1,
+	Comments: 1,
+}
+
+var personalWeights = FeedWeights{
+	Recency:   3,
+	Likes:     1,
+	Comments:  1,
+	Proximity: 2,
+	Pet:       2,
+	Category:  1.5,
+	Hospital:  2,
+}
+
+// FeedProfile is what the feed knows about the user it ranks for.
+type FeedProfile struct {
+	Near        *NearRequest
+	Pets        []Pet
+	Categories  map[string]float64 // Read count of each category, 0 to 1
+	HospitalIds map[bson.ObjectId]bool
+}
+
+func feedSeenKey(userId bson.ObjectId) string {
+	return "feed:seen:" + userId.Hex()
+}
+
+func feedCategoriesKey(userId bson.ObjectId) string {
+	return "feed:categories:" + userId.Hex()
+}
+
+// NewFeedProfile loads pets, read categories and followed hospitals of user.
+func NewFeedProfile(userId bson.ObjectId) (profile FeedProfile, err error) {
+	if err = dbcPets.Find(bson.M{"userid": userId}).All(&profile.Pets); err != nil {
+		return
+	}
+
+	profile.HospitalIds = make(map[bson.ObjectId]bool)
+	for _, id := range followingIds(userId, "hospital") {
+		profile.HospitalIds[id] = true
+	}
+
+	profile.Categories = make(map[string]float64)
+	if client != nil {
+		read, err := client.ZRevRangeWithScores(feedCategoriesKey(userId), 0, 9).Result()
+		if err != nil && err != redis.Nil {
+			log.Print(err)
+		}
+		for _, z := range read {
+			// Most read category is 1
+			if category, ok := z.Member.(string); ok && read[0].Score > 0 {
+				profile.Categories[category] = z.Score / read[0].Score
+			}
+		}
+	}
+
+	return profile, nil
+}
+
+// markFeedRead counts categories of review read by user.
+func markFeedRead(userId bson.ObjectId, review *Review) {
+	if client == nil || len(review.Categories) == 0 {
+		return
+	}
+
+	key := feedCategoriesKey(userId)
+	for _, category := range review.Categories {
+		if err := client.ZIncrBy(key, 1, category).Err(); err != nil {
+			log.Print(err)
+			return
+		}
+	}
+	client.Expire(key, feedReadExpiry)
+}
+
+func markFeedSeen(userId bson.ObjectId, reviews []Review) {
+	if client == nil || len(reviews) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(reviews))
+	for _, review := range reviews {
+		ids = append(ids, review.Id.Hex())
+	}
+
+	key := feedSeenKey(userId)
+	if err := client.SAdd(key, ids...).Err(); err != nil {
+		log.Print(err)
+		return
+	}
+	client.Expire(key, feedSeenExpiry)
+}
+
+func feedSeenIds(userId bson.ObjectId) []bson.ObjectId {
+	if client == nil {
+		return nil
+	}
+
+	members, err := client.SMembers(feedSeenKey(userId)).Result()
+	if err != nil {
+		log.Print(err)
+		return nil
+	}
+
+	ids := make([]bson.ObjectId, 0, len(members))
+	for _, member := range members {
+		if bson.IsObjectIdHex(member) {
+			ids = append(ids, bson.ObjectIdHex(member))
+		}
+	}
+	return ids
+}
+
+// distanceMeters returns meters between two points on Earth.
+func distanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(a))
+}
+
+// petScore is 1 when review is about a pet like one of pets.
+func petScore(review *Review, pets []Pet) float64 {
+	best := 0.0
+	for _, pet := range pets {
+		if pet.Type != review.PetType {
+			continue
+		}
+
+		score := 0.5
+		if pet.Size == review.PetSize {
+			score += 0.25
+		}
+		if math.Abs(float64(pet.Age-review.PetAge)) <= 2 {
+			score += 0.25
+		}
+		best = math.Max(best, score)
+	}
+	return best
+}
+
+// FeedScore scores review for profile. Profile may be nil for trending.
+func FeedScore(review *Review, profile *FeedProfile, weights FeedWeights, now time.Time) float64 {
+	age := now.Sub(review.Created)
+	score := weights.Recency * math.Pow(0.5, float64(age)/float64(feedHalfLife))
+	score += weights.Likes * math.Log1p(float64(review.LikeCount))
+	score += weights.Comments * math.Log1p(float64(len(review.Comments)))
+
+	if profile == nil {
+		return score
+	}
+
+	if profile.Near != nil && len(review.Location.Coordinates) == 2 {
+		meters := distanceMeters(profile.Near.Latitude, profile.Near.Longitude,
+			review.Location.Coordinates[1], review.Location.Coordinates[0])
+		score += weights.Proximity * feedNearDistance / (feedNearDistance + meters)
+	}
+
+	score += weights.Pet * petScore(review, profile.Pets)
+
+	categoryScore := 0.0
+	for _, category := range review.Categories {
+		categoryScore = math.Max(categoryScore, profile.Categories[category])
+	}
+	score += weights.Category * categoryScore
+
+	if profile.HospitalIds[review.HospitalId] {
+		score += weights.Hospital
+	}
+
+	return score
+}
+
+// rankedReviews sorts reviews by scores, highest first.
+type rankedReviews struct {
+	reviews []Review
+	scores  []float64
+}
+
+func (r rankedReviews) Len() int           { return len(r.reviews) }
+func (r rankedReviews) Less(a, b int) bool { return r.scores[a] > r.scores[b] }
+func (r rankedReviews) Swap(a, b int) {
+	r.reviews[a], r.reviews[b] = r.reviews[b], r.reviews[a]
+	r.scores[a], r.scores[b] = r.scores[b], r.scores[a]
+}
+
+// rankFeed returns limit reviews of candidates with the highest scores.
+func rankFeed(candidates []Review, profile *FeedProfile, weights FeedWeights, limit int) []Review {
+	now := time.Now()
+	ranked := rankedReviews{reviews: candidates, scores: make([]float64, len(candidates))}
+	for n := range candidates {
+		ranked.scores[n] = FeedScore(&candidates[n], profile, weights, now)
+	}
+
+	sort.Stable(ranked)
+
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+func feedCandidates(exclude []bson.ObjectId) ([]Review, error) {
+	rq := NewReviewQuery()
+	rq.Range("created", "$gte", time.Now().AddDate(0, 0, -feedCandidateDays))
+	query := rq.Query()
+	if len(exclude) > 0 {
+		query["_id"] = bson.M{"$nin": exclude}
+	}
+
+	var reviews []Review
+	err := dbcReviews.Find(query).Sort("-created").Limit(feedCandidateLimit).All(&reviews)
+	return reviews, err
+}
+
+func getFeedLimit(gc *gin.Context) int {
+	limit, err := strconv.Atoi(gc.Query("limit"))
+	if err != nil || limit <= 0 {
+		return DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return limit
+}
+
+func feedResponse(gc *gin.Context, reviews []Review, hasMore bool) {
+	if len(reviews) == 0 {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No reviews.", "has_more": false})
+		return
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(reviews)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":   0,
+		"message":  "Successfully fetched Feed.",
+		"reviews":  reviews,
+		"has_more": hasMore,
+	})
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+// getFeed responds with reviews ranked for the user. Request it again for
+// more reviews. latitude and longitude in query rank nearby reviews higher.
+// reset=true serves seen reviews again.
+func getFeed(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	profile, err := NewFeedProfile(myAccount.Id)
+	if err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	if gc.Query("latitude") != "" || gc.Query("longitude") != "" {
+		var near NearRequest
+		if near.Latitude, err = queryFloat(gc, "latitude"); err == nil {
+			near.Longitude, err = queryFloat(gc, "longitude")
+		}
+		if err != nil {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+			return
+		}
+		profile.Near = &near
+	}
+
+	if gc.Query("reset") == "true" && client != nil {
+		client.Del(feedSeenKey(myAccount.Id))
+	}
+
+	candidates, err := feedCandidates(feedSeenIds(myAccount.Id))
+	if err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	limit := getFeedLimit(gc)
+	hasMore := len(candidates) > limit
+	reviews := rankFeed(candidates, &profile, personalWeights, limit)
+
+	markFeedSeen(myAccount.Id, reviews)
+	setReviewsViewer(reviews, myAccount.Id)
+	feedResponse(gc, reviews, hasMore)
+}
+
+// getTrending responds with reviews ranked by recency, likes and comments.
+func getTrending(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	candidates, err := feedCandidates(nil)
+	if err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	reviews := rankFeed(candidates, nil, trendingWeights, getFeedLimit(gc))
+
+	setReviewsViewer(reviews, myAccount.Id)
+	feedResponse(gc, reviews, false)
+}
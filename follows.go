@@ -0,0 +1,454 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const TableNameFollows = "follows"
+
+var dbcFollows *mgo.Collection
+
+func init() {
+	const tableName = TableNameFollows
+	dbcFollows = dbSession.DB(dbName).C(tableName)
+	dbCols[tableName] = dbcFollows
+
+	index := mgo.Index{
+		Key:        []string{"userid", "category", "relatedid"},
+		Unique:     true,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	index = mgo.Index{
+		Key:        []string{"category", "relatedid", "-created"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+}
+
+// Types of notifications sent to followers.
+const (
+	NotificationFollowReview   = "follow_review"   // A followed user posted a review
+	NotificationHospitalReview = "hospital_review" // A followed hospital got a review
+)
+
+// Follow of a user or hospital by user UserId.
+type Follow struct {
+	Id        bson.ObjectId `bson:"_id" json:"id"`
+	UserId    bson.ObjectId `json:"userid"` // Follower
+	Category  string        `json:"category"`
+	RelatedId bson.ObjectId `json:"relatedid"` // Followed user or hospital
+	Created   time.Time     `json:"created"`
+}
+
+// followCategory returns the collection keeping follower count of the
+// followed in category.
+func followCategory(category string) (*mgo.Collection, bool) {
+	switch category {
+	case "user":
+		return dbcUserData, true
+	case "hospital":
+		return dbcHospitals, true
+	}
+	return nil, false
+}
+
+////////////////////////      BASIC OPERATIONS     ///////////////////////////
+
+// Insert saves the follow and counts it on both sides.
+func (i *Follow) Insert() (bson.ObjectId, error) {
+	col, ok := followCategory(i.Category)
+	if ok == false {
+		return i.Id, errors.New("Unknown category.")
+	}
+
+	if i.Id.Valid() == false {
+		i.Id = bson.NewObjectId()
+	}
+	i.Created = time.Now()
+
+	if err := dbcFollows.Insert(&i); err != nil {
+		log.Println("Could not insert a follow.")
+		return i.Id, err
+	}
+
+	// UserData of the followed may not be saved yet.
+	if _, err := col.UpsertId(i.RelatedId, bson.M{"$inc": bson.M{"followercount": 1}}); err != nil {
+		log.Print(err)
+	}
+	if _, err := dbcUserData.UpsertId(i.UserId, bson.M{"$inc": bson.M{"followingcount": 1}}); err != nil {
+		log.Print(err)
+	}
+
+	return i.Id, nil
+}
+
+func (i *Follow) Delete() (err error) {
+	if i.Id.Valid() == false {
+		return errors.New("Invalid Follow Id")
+	}
+
+	if err = dbcFollows.RemoveId(i.Id); err != nil {
+		return
+	}
+
+	if col, ok := followCategory(i.Category); ok {
+		if err := col.UpdateId(i.RelatedId, bson.M{"$inc": bson.M{"followercount": -1}}); err != nil {
+			log.Print(err)
+		}
+	}
+	if err := dbcUserData.UpdateId(i.UserId, bson.M{"$inc": bson.M{"followingcount": -1}}); err != nil {
+		log.Print(err)
+	}
+
+	return nil
+}
+
+// Find finds the follow of UserId on Category and RelatedId.
+func (i *Follow) Find() error {
+	return dbcFollows.Find(bson.M{
+		"userid":    i.UserId,
+		"category":  i.Category,
+		"relatedid": i.RelatedId,
+	}).One(&i)
+}
+
+func isFollowing(userId bson.ObjectId, category string, relatedId bson.ObjectId) bool {
+	n, err := dbcFollows.Find(bson.M{"userid": userId, "category": category, "relatedid": relatedId}).Count()
+	if err != nil {
+		log.Print(err)
+	}
+	return n > 0
+}
+
+// followingIds returns ids of users or hospitals userId follows.
+func followingIds(userId bson.ObjectId, category string) []bson.ObjectId {
+	var follows []Follow
+	if err := dbcFollows.Find(bson.M{"userid": userId, "category": category}).All(&follows); err != nil {
+		log.Print(err)
+	}
+
+	ids := make([]bson.ObjectId, 0, len(follows))
+	for _, follow := range follows {
+		ids = append(ids, follow.RelatedId)
+	}
+	return ids
+}
+
+// notifyFollowers notifies staff of the hospital, and followers of the author
+// and of the hospital of the review just published. A user is notified once.
+func notifyFollowers(review Review) {
+	var userData UserData
+	if err := userData.GetById(review.UserId); err != nil {
+		userData.Nickname = "No nickname"
+	}
+
+	notified := map[bson.ObjectId]bool{review.UserId: true}
+	notify := func(category string, relatedId bson.ObjectId, notificationType string, message string) {
+		var follows []Follow
+		if err := dbcFollows.Find(bson.M{"category": category, "relatedid": relatedId}).All(&follows); err != nil {
+			log.Print(err)
+			return
+		}
+
+		for _, follow := range follows {
+			if notified[follow.UserId] {
+				continue
+			}
+			notified[follow.UserId] = true
+
+			notification := Notification{
+				Id:          bson.NewObjectId(), // Insert a new Notification
+				UserId:      follow.UserId,      // Follower sees this notification
+				Type:        notificationType,
+				Message:     message,
+				RelatedType: "review",
+				RelatedId:   review.Id,
+				IsRead:      false, // It's new and not read.
+				IsSent:      false,
+			}
+
+			if _, err := notification.Insert(); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+
+	// Followers of the author must not learn the anonymous review is theirs.
+	if review.IsAnonymous == false {
+		notify("user", review.UserId, NotificationFollowReview, userData.Nickname)
+	}
+
+	if review.HospitalId.Valid() {
+		var hospital Hospital
+		if err := hospital.GetById(review.HospitalId); err == nil {
+			for _, userId := range staffIds(hospital.Id) {
+				if notified[userId] {
+					continue
+				}
+				notified[userId] = true
+
+				notification := Notification{
+					Id:          bson.NewObjectId(), // Insert a new Notification
+					UserId:      userId,             // Staff sees this notification
+					Type:        NotificationStaffReview,
+					Message:     hospital.Name,
+					RelatedType: "review",
+					RelatedId:   review.Id,
+					IsRead:      false, // It's new and not read.
+					IsSent:      false,
+				}
+
+				if _, err := notification.Insert(); err != nil {
+					log.Print(err)
+				}
+			}
+
+			notify("hospital", hospital.Id, NotificationHospitalReview, hospital.Name)
+		}
+	}
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+func insertFollow(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	category := gc.Param("category")
+	if _, ok := followCategory(category); ok == false {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Unknown category."})
+		return
+	}
+
+	relatedId, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	if category == "user" {
+		if relatedId == myAccount.Id {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Cannot follow yourself."})
+			return
+		}
+
+		var user User
+		if err := user.GetById(relatedId); err != nil || user.IsDeleted {
+			DataNotFound(gc)
+			return
+		}
+	} else {
+		relatedId = resolveHospitalId(relatedId)
+		if n, err := dbcHospitals.FindId(relatedId).Count(); err != nil || n == 0 {
+			DataNotFound(gc)
+			return
+		}
+	}
+
+	follow := Follow{
+		UserId:    myAccount.Id,
+		Category:  category,
+		RelatedId: relatedId,
+	}
+
+	if _, err := follow.Insert(); mgo.IsDup(err) {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Already following."})
+		return
+
+	} else if err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Following!"})
+}
+
+func deleteFollow(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	relatedId, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	follow := Follow{
+		UserId:    myAccount.Id,
+		Category:  gc.Param("category"),
+		RelatedId: relatedId,
+	}
+
+	if err := follow.Find(); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Not following."})
+		return
+	}
+
+	if err := follow.Delete(); err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Unfollowed."})
+}
+
+// listFollows responds with a page of follows matching query. Each follow
+// has the nickname of the follower when listing followers, or of the
+// followed user or the followed hospital otherwise.
+func listFollows(gc *gin.Context, query bson.M, followers bool) {
+	page, err := getPageFromQuery(gc, DefaultPageLimit, SortKeyCreated, true)
+	if err != nil {
+		return
+	}
+
+	var follows []Follow
+	if err := dbcFollows.Find(page.Query(query)).Sort(page.Sort()...).Limit(page.QueryLimit()).All(&follows); err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	hasMore := page.HasMore(len(follows))
+	nextCursor := ""
+	if hasMore {
+		follows = follows[:page.Limit]
+		last := follows[len(follows)-1]
+		nextCursor = NewCursor(last.Created, last.Id).Encode()
+	}
+
+	now := time.Now()
+	results := make([]gin.H, 0, len(follows))
+	for _, follow := range follows {
+		result := gin.H{"follow": follow}
+		if followers == false && follow.Category == "hospital" {
+			var hospital Hospital
+			if err := hospital.GetById(follow.RelatedId); err != nil {
+				continue
+			}
+			hospital.SetOpenStatus(now)
+			result["hospital"] = hospital
+		} else {
+			userId := follow.UserId
+			if followers == false {
+				userId = follow.RelatedId
+			}
+
+			var userData UserData
+			if err := userData.GetById(userId); err != nil {
+				userData.Nickname = "No nickname"
+			}
+			result["nickname"] = userData.Nickname
+			result["imageid"] = userData.ProfileImageId
+		}
+		results = append(results, result)
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(results)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully fetched Follows.",
+		"follows":     results,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
+}
+
+// getFollowers lists users following the user or hospital.
+func getFollowers(gc *gin.Context) {
+	loggedIn, _ := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	category := gc.Param("category")
+	if _, ok := followCategory(category); ok == false {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Unknown category."})
+		return
+	}
+
+	relatedId, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	listFollows(gc, bson.M{"category": category, "relatedid": relatedId}, true)
+}
+
+// getFollowing lists users and hospitals the user follows. "category" in
+// query lists only users or hospitals.
+func getFollowing(gc *gin.Context) {
+	loggedIn, _ := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	userId, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	query := bson.M{"userid": userId}
+	if category := gc.Query("category"); category != "" {
+		if _, ok := followCategory(category); ok == false {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Unknown category."})
+			return
+		}
+		query["category"] = category
+	}
+
+	listFollows(gc, query, false)
+}
+
+// getFollowingReviews lists reviews by followed users and at followed hospitals.
+func getFollowingReviews(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	userIds := followingIds(myAccount.Id, "user")
+	hospitalIds := followingIds(myAccount.Id, "hospital")
+	if len(userIds) == 0 && len(hospitalIds) == 0 {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Not following anyone.", "has_more": false})
+		return
+	}
+
+	rq := NewReviewQuery()
+	if err := rq.Parse(gc); err != nil {
+		return
+	}
+
+	rq.Filter["$or"] = []bson.M{
+		{"userid": bson.M{"$in": userIds}, "isanonymous": bson.M{"$ne": true}},
+		{"hospitalid": bson.M{"$in": hospitalIds}},
+	}
+
+	listReviews(gc, rq, DefaultPageLimit, myAccount.Id)
+}
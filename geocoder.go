@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Reverse geocoding finds the 시/구/동 of a point in administrative boundaries
+// loaded from a local GeoJSON file, such as the 행정동 boundaries published
+// by the Ministry of the Interior. No external API is called.
+var regionsFile = flag.String("regions", "regions.geojson", "GeoJSON of 시/구/동 boundaries for reverse geocoding")
+
+// Points off the boundaries within the distance in meters are of the
+// nearest region. Boundaries are simplified and GPS is off near the coast.
+const regionTolerance = 500
+
+var ErrOutsideKorea = errors.New("Location is outside Korea.")
+
+// Region is an administrative region of a point.
+type Region struct {
+	Code    string   `bson:"code,omitempty" json:"code,omitempty"`
+	Sido    string   `bson:"sido" json:"sido"`                           // 서울특별시
+	Sigungu string   `bson:"sigungu,omitempty" json:"sigungu,omitempty"` // 강남구, 수원시 장안구
+	Dong    string   `bson:"dong,omitempty" json:"dong,omitempty"`       // 역삼1동
+	Names   []string `bson:"names" json:"-"`                             // Each name for region filters
+}
+
+func (r *Region) Name() string {
+	return strings.Join(strings.Fields(r.Sido+" "+r.Sigungu+" "+r.Dong), " ")
+}
+
+func (r *Region) setNames() {
+	r.Names = strings.Fields(r.Name())
+	if len(strings.Fields(r.Sigungu)) > 1 {
+		r.Names = append(r.Names, r.Sigungu)
+	}
+}
+
+// Property names of a region in boundary datasets.
+var regionProperties = map[string][]string{
+	"code":    {"adm_cd", "adm_cd2", "code", "EMD_CD", "ADM_DR_CD"},
+	"sido":    {"sidonm", "sido", "CTP_KOR_NM"},
+	"sigungu": {"sggnm", "sigungu", "SIG_KOR_NM"},
+	"dong":    {"dong", "EMD_KOR_NM", "ADM_DR_NM"},
+	"name":    {"adm_nm", "name"}, // Full name as "서울특별시 강남구 역삼1동"
+}
+
+func regionProperty(properties map[string]interface{}, name string) string {
+	for _, key := range regionProperties[name] {
+		if value, ok := properties[key]; ok && value != nil {
+			return strings.TrimSpace(fmt.Sprint(value))
+		}
+	}
+	return ""
+}
+
+// newRegion reads the region from properties of a boundary.
+func newRegion(properties map[string]interface{}) Region {
+	region := Region{
+		Code:    regionProperty(properties, "code"),
+		Sido:    regionProperty(properties, "sido"),
+		Sigungu: regionProperty(properties, "sigungu"),
+		Dong:    regionProperty(properties, "dong"),
+	}
+
+	// Dong is the last of the full name when not given.
+	if words := strings.Fields(regionProperty(properties, "name")); len(words) > 0 {
+		if region.Sido == "" {
+			region.Sido = words[0]
+		}
+		if region.Dong == "" && len(words) > 1 {
+			region.Dong = words[len(words)-1]
+		}
+		if region.Sigungu == "" && len(words) > 2 {
+			region.Sigungu = strings.Join(words[1:len(words)-1], " ")
+		}
+	}
+
+	region.setNames()
+	return region
+}
+
+type ring [][2]float64
+
+// boundary is the polygons of a region in longitude and latitude.
+type boundary struct {
+	region   Region
+	polygons [][]ring // Outer ring followed by holes
+	min, max [2]float64
+}
+
+var boundaries []boundary
+
+// contains tells if the point is in the ring by ray casting.
+func (r ring) contains(lon, lat float64) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		if (r[i][1] > lat) != (r[j][1] > lat) &&
+			lon < (r[j][0]-r[i][0])*(lat-r[i][1])/(r[j][1]-r[i][1])+r[i][0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// distance returns the distance in meters from the point to the ring. It
+// is approximated on a plane, which is fine within the tolerance.
+func (r ring) distance(lon, lat float64) float64 {
+	const metersPerDegree = EarthRadius * math.Pi / 180
+	scale := math.Cos(lat * math.Pi / 180)
+
+	min := math.Inf(1)
+	for i := 1; i < len(r); i++ {
+		ax, ay := (r[i-1][0]-lon)*scale, r[i-1][1]-lat
+		bx, by := (r[i][0]-lon)*scale, r[i][1]-lat
+
+		// Nearest point on the segment to the origin
+		dx, dy := bx-ax, by-ay
+		t := 0.0
+		if length := dx*dx + dy*dy; length > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+		}
+		x, y := ax+t*dx, ay+t*dy
+		min = math.Min(min, math.Hypot(x, y))
+	}
+	return min * metersPerDegree
+}
+
+func (b *boundary) contains(lon, lat float64) bool {
+	if lon < b.min[0] || lon > b.max[0] || lat < b.min[1] || lat > b.max[1] {
+		return false
+	}
+
+	for _, polygon := range b.polygons {
+		if polygon[0].contains(lon, lat) == false {
+			continue
+		}
+
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if hole.contains(lon, lat) {
+				inHole = true
+				break
+			}
+		}
+		if inHole == false {
+			return true
+		}
+	}
+	return false
+}
+
+// distance returns the distance in meters from the point to the boundary,
+// or +Inf when it is too far off to tell.
+func (b *boundary) distance(lon, lat float64) float64 {
+	margin := regionTolerance / (EarthRadius * math.Pi / 180) / math.Cos(lat*math.Pi/180)
+	if lon < b.min[0]-margin || lon > b.max[0]+margin || lat < b.min[1]-margin || lat > b.max[1]+margin {
+		return math.Inf(1)
+	}
+
+	min := math.Inf(1)
+	for _, polygon := range b.polygons {
+		min = math.Min(min, polygon[0].distance(lon, lat))
+	}
+	return min
+}
+
+// parsePolygons reads coordinates of Polygon or MultiPolygon geometry in crs.
+func parsePolygons(geometryType string, coordinates json.RawMessage, crs string) ([][]ring, error) {
+	var raw [][][][]float64
+	switch geometryType {
+	case "Polygon":
+		var polygon [][][]float64
+		if err := json.Unmarshal(coordinates, &polygon); err != nil {
+			return nil, err
+		}
+		raw = [][][][]float64{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(coordinates, &raw); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("Unsupported geometry: " + geometryType)
+	}
+
+	polygons := make([][]ring, 0, len(raw))
+	for _, rawPolygon := range raw {
+		var polygon []ring
+		for _, rawRing := range rawPolygon {
+			r := make(ring, 0, len(rawRing))
+			for _, point := range rawRing {
+				if len(point) < 2 {
+					return nil, errors.New("Invalid coordinates")
+				}
+				lon, lat, err := toWGS84(crs, point[0], point[1])
+				if err != nil {
+					return nil, err
+				}
+				r = append(r, [2]float64{lon, lat})
+			}
+			polygon = append(polygon, r)
+		}
+		if len(polygon) > 0 {
+			polygons = append(polygons, polygon)
+		}
+	}
+	return polygons, nil
+}
+
+// loadRegions loads boundaries of regions from the GeoJSON file.
+func loadRegions(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var collection struct {
+		Crs struct {
+			Properties struct {
+				Name string `json:"name"`
+			} `json:"properties"`
+		} `json:"crs"`
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(file).Decode(&collection); err != nil {
+		return err
+	}
+
+	loaded := make([]boundary, 0, len(collection.Features))
+	for n, feature := range collection.Features {
+		polygons, err := parsePolygons(feature.Geometry.Type, feature.Geometry.Coordinates, collection.Crs.Properties.Name)
+		if err != nil {
+			return fmt.Errorf("Feature %d: %s", n+1, err.Error())
+		}
+
+		b := boundary{
+			region:   newRegion(feature.Properties),
+			polygons: polygons,
+			min:      [2]float64{math.Inf(1), math.Inf(1)},
+			max:      [2]float64{math.Inf(-1), math.Inf(-1)},
+		}
+		if b.region.Sido == "" {
+			return fmt.Errorf("Feature %d: No region name", n+1)
+		}
+		for _, polygon := range polygons {
+			for _, point := range polygon[0] {
+				b.min = [2]float64{math.Min(b.min[0], point[0]), math.Min(b.min[1], point[1])}
+				b.max = [2]float64{math.Max(b.max[0], point[0]), math.Max(b.max[1], point[1])}
+			}
+		}
+		loaded = append(loaded, b)
+	}
+
+	boundaries = loaded
+	log.Printf("Loaded %d regions from %s.", len(boundaries), path)
+	return nil
+}
+
+// lookupRegion returns the region of the point, or of the nearest boundary
+// within regionTolerance.
+func lookupRegion(lon, lat float64) (Region, bool) {
+	nearest := -1
+	nearestDistance := float64(regionTolerance)
+	for n := range boundaries {
+		if boundaries[n].contains(lon, lat) {
+			return boundaries[n].region, true
+		}
+		if d := boundaries[n].distance(lon, lat); d <= nearestDistance {
+			nearest, nearestDistance = n, d
+		}
+	}
+
+	if nearest < 0 {
+		return Region{}, false
+	}
+	return boundaries[nearest].region, true
+}
+
+// regionOf returns the region of location, or nil when not found.
+func regionOf(location GeoJson) *Region {
+	if len(location.Coordinates) < 2 {
+		return nil
+	}
+	if region, ok := lookupRegion(location.Coordinates[0], location.Coordinates[1]); ok {
+		return &region
+	}
+	return nil
+}
+
+// setRegion sets the region and location name of the review from its
+// location. Kept as they are while boundaries are not loaded.
+func (i *Review) setRegion() {
+	if len(boundaries) == 0 {
+		return
+	}
+
+	i.Region = regionOf(i.Location)
+	if i.Region != nil {
+		i.LocationName = i.Region.Name()
+	}
+}
+
+// setRegion sets the region of the hospital from its location, and the
+// address to the region when not given.
+func (i *Hospital) setRegion() {
+	if len(boundaries) == 0 {
+		return
+	}
+
+	i.Region = regionOf(i.Location)
+	if i.Region != nil && strings.TrimSpace(i.Address) == "" {
+		i.Address = i.Region.Name()
+	}
+}
+
+// validateLocation rejects location outside Korea. Boundaries decide when
+// loaded. No location is valid.
+func validateLocation(location GeoJson) error {
+	if len(location.Coordinates) < 2 {
+		return nil
+	}
+
+	lon, lat := location.Coordinates[0], location.Coordinates[1]
+	if isInKorea(lon, lat) == false {
+		return ErrOutsideKorea
+	}
+	if len(boundaries) > 0 {
+		if _, ok := lookupRegion(lon, lat); ok == false {
+			return ErrOutsideKorea
+		}
+	}
+	return nil
+}
+
+// regionQuery matches documents in the region named like "강남구" or
+// "서울 중구". Every word names the region or one above it.
+func regionQuery(name string) bson.M {
+	words := strings.Fields(name)
+	for n, word := range words {
+		if province, ok := provinceNames[word]; ok {
+			words[n] = province
+		}
+	}
+	return bson.M{"region.names": bson.M{"$all": words}}
+}
+
+// backfillRegions sets regions of hospitals and reviews located before
+// boundaries were loaded.
+func backfillRegions() {
+	for _, tableName := range []string{TableNameHospitals, TableNameReviews} {
+		var doc struct {
+			Id       bson.ObjectId `bson:"_id"`
+			Location GeoJson       `bson:"location"`
+		}
+
+		iter := dbCols[tableName].Find(bson.M{
+			"region":               bson.M{"$exists": false},
+			"location.coordinates": bson.M{"$exists": true},
+		}).Select(bson.M{"location": 1}).Iter()
+
+		n := 0
+		for iter.Next(&doc) {
+			region := regionOf(doc.Location)
+			if region == nil {
+				continue
+			}
+			if err := dbCols[tableName].UpdateId(doc.Id, bson.M{"$set": bson.M{"region": region}}); err != nil {
+				log.Print(err)
+				continue
+			}
+			n++
+		}
+		if err := iter.Close(); err != nil {
+			log.Print(err)
+		}
+
+		if n > 0 {
+			log.Printf("Set regions of %d %s.", n, tableName)
+		}
+	}
+}
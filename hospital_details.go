@@ -0,0 +1,189 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	recentReviewsLimit = 3
+	topCategoriesLimit = 5
+	photoStripLimit    = 12
+	snippetLength      = 100
+)
+
+// HospitalDetail is a hospital with a summary of its reviews for its page.
+// Rating aggregates are in Hospital.
+type HospitalDetail struct {
+	Hospital      Hospital        `json:"hospital"`
+	ReviewCount   int             `json:"review_count"`
+	RecentReviews []ReviewSnippet `json:"recent_reviews"`
+	TopCategories []CategoryCount `json:"top_categories"`
+	Photos        []Image         `json:"photos"` // Images of recent reviews
+}
+
+type ReviewSnippet struct {
+	Id        bson.ObjectId `json:"id"`
+	UserId    bson.ObjectId `json:"userid,omitempty"` // Empty when anonymous
+	Snippet   string        `json:"snippet"`
+	Rating    *Rating       `json:"rating,omitempty"`
+	LikeCount int           `json:"like_count"`
+	Created   time.Time     `json:"created"`
+}
+
+type CategoryCount struct {
+	Category string `bson:"_id" json:"category"`
+	Count    int    `bson:"count" json:"count"`
+}
+
+// snippet cuts text to length runes.
+func snippet(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length]) + "..."
+}
+
+// hospitalReviewsQuery matches published reviews of the hospital.
+func hospitalReviewsQuery(hospitalId bson.ObjectId) bson.M {
+	rq := NewReviewQuery()
+	rq.Hospital(hospitalId)
+	return rq.Query()
+}
+
+// NewHospitalDetail summarizes reviews of hospital.
+func NewHospitalDetail(hospital Hospital) (detail HospitalDetail, err error) {
+	detail.Hospital = hospital
+	query := hospitalReviewsQuery(hospital.Id)
+
+	if detail.ReviewCount, err = dbcReviews.Find(query).Count(); err != nil {
+		return
+	}
+
+	var recent []Review
+	if err = dbcReviews.Find(query).Sort("-created").Limit(recentReviewsLimit).All(&recent); err != nil {
+		return
+	}
+
+	detail.RecentReviews = make([]ReviewSnippet, 0, len(recent))
+	for _, review := range recent {
+		review.SetViewer("")
+		detail.RecentReviews = append(detail.RecentReviews, ReviewSnippet{
+			Id:        review.Id,
+			UserId:    review.UserId,
+			Snippet:   snippet(review.ReviewBody, snippetLength),
+			Rating:    review.Rating,
+			LikeCount: review.LikeCount,
+			Created:   review.Created,
+		})
+	}
+
+	if err = dbcReviews.Pipe([]bson.M{
+		{"$match": query},
+		{"$unwind": "$categories"},
+		{"$group": bson.M{"_id": "$categories", "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.D{{Name: "count", Value: -1}, {Name: "_id", Value: 1}}},
+		{"$limit": topCategoriesLimit},
+	}).All(&detail.TopCategories); err != nil {
+		return
+	}
+	if detail.TopCategories == nil {
+		detail.TopCategories = []CategoryCount{}
+	}
+
+	// Photos are taken from the latest reviews having images.
+	var withImages []Review
+	imageQuery := hospitalReviewsQuery(hospital.Id)
+	imageQuery["images.0"] = bson.M{"$exists": true}
+	if err = dbcReviews.Find(imageQuery).Select(bson.M{"images": 1}).Sort("-created").Limit(photoStripLimit).All(&withImages); err != nil {
+		return
+	}
+
+	var imageIds []bson.ObjectId
+	for _, review := range withImages {
+		for _, id := range review.Images {
+			if len(imageIds) < photoStripLimit {
+				imageIds = append(imageIds, id)
+			}
+		}
+	}
+
+	detail.Photos = []Image{}
+	if len(imageIds) > 0 {
+		err = dbcImages.Find(bson.M{"_id": bson.M{"$in": imageIds}}).Sort("-created").All(&detail.Photos)
+	}
+	return
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+// getHospitalReviews lists published reviews of the hospital. Sort and
+// filters are the same as of GET /reviews.
+//
+// It is GET /hospital/reviews/:id, not /hospital/:id/reviews, as the router
+// does not allow a wildcard where /hospital/get/:id and others are static.
+func getHospitalReviews(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var hospital Hospital
+	if err := hospital.GetById(id); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	rq := NewReviewQuery()
+	if err := rq.Parse(gc); err != nil {
+		return
+	}
+	rq.Hospital(hospital.Id)
+
+	listReviews(gc, rq, DefaultPageLimit, myAccount.Id)
+}
+
+func getHospitalDetail(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var hospital Hospital
+	if err := hospital.GetById(id); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	hospital.SetLiked(myAccount.Id)
+	hospital.Followed = isFollowing(myAccount.Id, "hospital", hospital.Id)
+	hospital.SetOpenStatus(time.Now())
+
+	detail, err := NewHospitalDetail(hospital)
+	if err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":  0,
+		"message": "Successfully fetched Hospital.",
+		"detail":  detail,
+	})
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Hospitals are imported from the veterinary clinic registry published as
+// CSV or GeoJSON by running the server with -importhospitals. Rows are
+// upserted by their registry id, so the same file can be imported again.
+//
+// Hospitals edited on our side after their last import are not overwritten.
+// Rows without registry id on our side but duplicating a hospital are
+// reported as conflicts to be merged by admins.
+
+// Defined before flags are parsed in isDevMode.
+var importHospitalsFile = flag.String("importhospitals", "", "Imports hospitals from the CSV or GeoJSON file and exits")
+var importCrs = flag.String("importcrs", "EPSG:5174", "Coordinate system of imported CSV coordinates, unless named in the header")
+var importDryRun = flag.Bool("importdryrun", false, "Reports what -importhospitals would do without writing")
+
+// Column names of the registry, and alternatives in other exports.
+var importColumns = map[string][]string{
+	"localgov": {"개방자치단체코드", "opnsfteamcode"},
+	"id":       {"관리번호", "mgtno", "id"},
+	"name":     {"사업장명", "bplcnm", "name"},
+	"status":   {"영업상태명", "trdstatenm", "status"},
+	"detail":   {"상세영업상태명", "dtlstatenm"},
+	"phone":    {"소재지전화", "sitetel", "phone"},
+	"road":     {"도로명전체주소", "rdnwhladdr", "road_address"},
+	"address":  {"소재지전체주소", "sitewhladdr", "address"},
+	"x":        {"좌표정보(x)", "좌표정보x", "x"}, // As "좌표정보x(epsg5174)" with headerCrs
+	"y":        {"좌표정보(y)", "좌표정보y", "y"},
+}
+
+// Statuses of closed hospitals.
+var closedStatuses = []string{"폐업", "취소", "말소", "휴업"}
+
+// ImportRow is a hospital read from a dataset.
+type ImportRow struct {
+	Line       int
+	ExternalId string
+	Name       string
+	Address    string
+	Phone      string
+	Status     string
+	Lon, Lat   float64
+}
+
+// ImportReport counts what was done with the rows.
+type ImportReport struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	Skipped   []string // Closed or invalid rows
+	Conflicts []string // Rows needing an admin
+}
+
+func (r *ImportReport) skip(row ImportRow, reason string) {
+	r.Skipped = append(r.Skipped, fmt.Sprintf("line %d %s: %s", row.Line, row.Name, reason))
+}
+
+func (r *ImportReport) conflict(row ImportRow, reason string) {
+	r.Conflicts = append(r.Conflicts, fmt.Sprintf("line %d %s: %s", row.Line, row.Name, reason))
+}
+
+func (r *ImportReport) Print() {
+	log.Printf("Import: %d created, %d updated, %d unchanged, %d skipped, %d conflicts.",
+		r.Created, r.Updated, r.Unchanged, len(r.Skipped), len(r.Conflicts))
+	for _, conflict := range r.Conflicts {
+		log.Println("Conflict: " + conflict)
+	}
+	for _, skipped := range r.Skipped {
+		log.Println("Skipped: " + skipped)
+	}
+}
+
+// Provinces as written in full in addresses.
+var provinceNames = map[string]string{
+	"서울":   "서울특별시",
+	"서울시":  "서울특별시",
+	"부산":   "부산광역시",
+	"부산시":  "부산광역시",
+	"대구":   "대구광역시",
+	"대구시":  "대구광역시",
+	"인천":   "인천광역시",
+	"인천시":  "인천광역시",
+	"광주":   "광주광역시",
+	"광주시":  "광주광역시",
+	"대전":   "대전광역시",
+	"대전시":  "대전광역시",
+	"울산":   "울산광역시",
+	"울산시":  "울산광역시",
+	"세종":   "세종특별자치시",
+	"세종시":  "세종특별자치시",
+	"경기":   "경기도",
+	"강원":   "강원특별자치도",
+	"강원도":  "강원특별자치도",
+	"충북":   "충청북도",
+	"충남":   "충청남도",
+	"전북":   "전북특별자치도",
+	"전라북도": "전북특별자치도",
+	"전남":   "전라남도",
+	"경북":   "경상북도",
+	"경남":   "경상남도",
+	"제주":   "제주특별자치도",
+	"제주도":  "제주특별자치도",
+}
+
+// normalizeAddress collapses spaces and writes the province in full.
+func normalizeAddress(address string) string {
+	words := strings.Fields(address)
+	if len(words) == 0 {
+		return ""
+	}
+	if province, ok := provinceNames[words[0]]; ok {
+		words[0] = province
+	}
+	return strings.Join(words, " ")
+}
+
+// formatPhone writes a Korean phone number with dashes as 02-123-4567.
+// Numbers it does not know are returned as digits.
+func formatPhone(phone string) string {
+	digits := normalizePhone(phone)
+	n := len(digits)
+
+	switch {
+	case n < 8:
+		return digits
+	case n == 8 && strings.HasPrefix(digits, "1"): // 1588-0000
+		return digits[:4] + "-" + digits[4:]
+	case strings.HasPrefix(digits, "02") && (n == 9 || n == 10):
+		return digits[:2] + "-" + digits[2:n-4] + "-" + digits[n-4:]
+	case strings.HasPrefix(digits, "050") && (n == 11 || n == 12):
+		return digits[:4] + "-" + digits[4:n-4] + "-" + digits[n-4:]
+	case strings.HasPrefix(digits, "0") && (n == 10 || n == 11):
+		return digits[:3] + "-" + digits[3:n-4] + "-" + digits[n-4:]
+	}
+	return digits
+}
+
+func isClosed(status string) bool {
+	for _, closed := range closedStatuses {
+		if strings.Contains(status, closed) {
+			return true
+		}
+	}
+	return false
+}
+
+// newImportRow makes a row from values by column names. crs is of x and y.
+func newImportRow(line int, values map[string]string, crs string) (row ImportRow, err error) {
+	row.Line = line
+	row.Name = strings.TrimSpace(values["name"])
+	row.Status = strings.TrimSpace(values["status"] + " " + values["detail"])
+	row.Phone = formatPhone(values["phone"])
+
+	row.Address = normalizeAddress(values["road"])
+	if row.Address == "" {
+		row.Address = normalizeAddress(values["address"])
+	}
+
+	row.ExternalId = strings.TrimSpace(values["id"])
+	if localGov := strings.TrimSpace(values["localgov"]); localGov != "" && row.ExternalId != "" {
+		row.ExternalId = localGov + "-" + row.ExternalId
+	}
+
+	if row.ExternalId == "" {
+		return row, errors.New("No id")
+	}
+	if row.Name == "" {
+		return row, errors.New("No name")
+	}
+
+	x, errX := strconv.ParseFloat(strings.TrimSpace(values["x"]), 64)
+	y, errY := strconv.ParseFloat(strings.TrimSpace(values["y"]), 64)
+	if errX != nil || errY != nil {
+		return row, errors.New("No coordinates")
+	}
+
+	// Some exports have degrees though named as projected.
+	if x >= -180 && x <= 180 && y >= -90 && y <= 90 {
+		crs = "WGS84"
+	}
+
+	if row.Lon, row.Lat, err = toWGS84(crs, x, y); err != nil {
+		return
+	}
+	if validateLocation(GeoJson{Type: "Point", Coordinates: []float64{row.Lon, row.Lat}}) != nil {
+		return row, fmt.Errorf("Coordinates %f %f out of Korea", row.Lon, row.Lat)
+	}
+
+	return row, nil
+}
+
+// columnName finds the column of header in importColumns. Coordinate system
+// named in parentheses is left out.
+func columnName(header string) string {
+	header = strings.ToLower(strings.Replace(strings.TrimSpace(header), " ", "", -1))
+	if n := strings.Index(header, "(epsg"); n >= 0 {
+		header = header[:n]
+	}
+	for name, alternatives := range importColumns {
+		for _, alternative := range alternatives {
+			if header == alternative {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// headerCrs returns the coordinate system named in header like
+// "좌표정보x(epsg5174)", or "" when not named.
+func headerCrs(header string) string {
+	header = strings.ToLower(header)
+	n := strings.Index(header, "epsg")
+	if n < 0 {
+		return ""
+	}
+
+	code := strings.TrimLeft(header[n+len("epsg"):], ":")
+	if end := strings.IndexFunc(code, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+		code = code[:end]
+	}
+	if code == "" {
+		return ""
+	}
+	return "EPSG:" + code
+}
+
+// readImportCSV reads rows of the CSV file in UTF-8. Coordinates are in crs
+// unless their columns name another.
+func readImportCSV(r io.Reader, crs string, report *ImportReport) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, len(header))
+	for n, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[n] = columnName(name)
+		if columns[n] == "x" || columns[n] == "y" {
+			if named := headerCrs(name); named != "" {
+				crs = named
+			}
+		}
+	}
+
+	found := strings.Join(columns, ",")
+	if strings.Contains(found, "id") == false || strings.Contains(found, "name") == false {
+		return nil, errors.New("No id or name column. CSV must be in UTF-8.")
+	}
+
+	var rows []ImportRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return rows, err
+		}
+
+		values := make(map[string]string)
+		for n, value := range record {
+			if n < len(columns) && columns[n] != "" {
+				if utf8.ValidString(value) == false {
+					return rows, errors.New("CSV is not in UTF-8. Convert it from CP949 first.")
+				}
+				values[columns[n]] = value
+			}
+		}
+
+		row, err := newImportRow(line, values, crs)
+		if err != nil {
+			report.skip(row, err.Error())
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readImportGeoJSON reads rows of Point features of the GeoJSON file. The
+// coordinate system is of "crs" in the file, or WGS84.
+func readImportGeoJSON(r io.Reader, report *ImportReport) ([]ImportRow, error) {
+	var collection struct {
+		Crs struct {
+			Properties struct {
+				Name string `json:"name"`
+			} `json:"properties"`
+		} `json:"crs"`
+		Features []struct {
+			Geometry   GeoJson                `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(r).Decode(&collection); err != nil {
+		return nil, err
+	}
+
+	var rows []ImportRow
+	for n, feature := range collection.Features {
+		values := make(map[string]string)
+		for key, value := range feature.Properties {
+			if name := columnName(key); name != "" && value != nil {
+				values[name] = fmt.Sprint(value)
+			}
+		}
+
+		if feature.Geometry.Type == "Point" && len(feature.Geometry.Coordinates) >= 2 {
+			values["x"] = strconv.FormatFloat(feature.Geometry.Coordinates[0], 'f', -1, 64)
+			values["y"] = strconv.FormatFloat(feature.Geometry.Coordinates[1], 'f', -1, 64)
+		}
+
+		row, err := newImportRow(n+1, values, collection.Crs.Properties.Name)
+		if err != nil {
+			report.skip(row, err.Error())
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// importRow creates or updates the hospital of row.
+func importRow(row ImportRow, now time.Time, dryRun bool, report *ImportReport) error {
+	if isClosed(row.Status) {
+		report.skip(row, "Closed")
+		return nil
+	}
+
+	location := GeoJson{Type: "Point", Coordinates: []float64{row.Lon, row.Lat}}
+
+	var hospital Hospital
+	if err := dbcHospitals.Find(bson.M{"externalid": row.ExternalId}).One(&hospital); err == nil {
+		if hospital.MergedInto.Valid() {
+			report.conflict(row, "Merged into "+hospital.MergedInto.Hex())
+			return nil
+		}
+
+		if hospital.Updated.After(hospital.Imported) {
+			report.conflict(row, "Edited after last import "+hospital.Id.Hex())
+			return nil
+		}
+
+		edit := hospital
+		edit.Name = row.Name
+		edit.Address = row.Address
+		edit.PhoneNumber = row.Phone
+		edit.Location = location
+		if len(hospitalChanges(&hospital, &edit, nil)) == 0 {
+			report.Unchanged++
+			return nil
+		}
+
+		report.Updated++
+		if dryRun {
+			return nil
+		}
+
+		edit.Updated = now
+		edit.Imported = now
+		return edit.saveEdit("imported")
+	}
+
+	hospital = Hospital{
+		Name:        row.Name,
+		Address:     row.Address,
+		PhoneNumber: row.Phone,
+		Location:    location,
+		ExternalId:  row.ExternalId,
+	}
+
+	duplicates, err := hospital.FindDuplicates()
+	if err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		report.conflict(row, "Duplicate of "+duplicates[0].Hospital.Id.Hex())
+		return nil
+	}
+
+	report.Created++
+	if dryRun {
+		return nil
+	}
+
+	if err := hospital.Insert(); err != nil {
+		return err
+	}
+
+	// Insert sets Updated. Imported is the same so it counts as not edited.
+	return dbcHospitals.UpdateId(hospital.Id, bson.M{"$set": bson.M{"imported": hospital.Updated}})
+}
+
+// ImportHospitals imports hospitals of the CSV or GeoJSON file.
+func ImportHospitals(filename string, crs string, dryRun bool) (report ImportReport, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var rows []ImportRow
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		rows, err = readImportCSV(file, crs, &report)
+	case ".geojson", ".json":
+		rows, err = readImportGeoJSON(file, &report)
+	default:
+		err = errors.New("Unknown file type: " + filename)
+	}
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, row := range rows {
+		if err := importRow(row, now, dryRun, &report); err != nil {
+			log.Print(err)
+			report.conflict(row, err.Error())
+		}
+	}
+
+	return report, nil
+}
+
+// runHospitalImport imports the file given by -importhospitals.
+func runHospitalImport() {
+	if *importDryRun {
+		log.Println("Dry run. Nothing is written.")
+	}
+
+	report, err := ImportHospitals(*importHospitalsFile, *importCrs, *importDryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report.Print()
+}
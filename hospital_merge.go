@@ -0,0 +1,478 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Hospitals within duplicateDistance meters of each other with names at
+// least duplicateSimilarity alike are likely the same. Hospitals with the
+// same phone number nearby are the same regardless of their names.
+const (
+	duplicateDistance   = 200
+	duplicateSimilarity = 0.6
+
+	maxMergeRedirects = 5 // Merged into a hospital merged later
+)
+
+// Common words in hospital names not telling hospitals apart.
+var hospitalNameSuffixes = []string{"동물메디컬센터", "동물의료센터", "동물병원", "병원", "animalhospital", "hospital"}
+
+// normalizeHospitalName lowercases name and drops spaces, symbols and
+// common suffixes.
+func normalizeHospitalName(name string) []rune {
+	var normalized string
+	for _, word := range splitWords(name) {
+		normalized += string(word)
+	}
+
+	for _, suffix := range hospitalNameSuffixes {
+		if trimmed := strings.TrimSuffix(normalized, suffix); trimmed != "" {
+			normalized = trimmed
+		}
+	}
+	return []rune(normalized)
+}
+
+// nameSimilarity is the Dice coefficient of rune bigrams of names. 1 for the
+// same names and 0 for names sharing no bigram.
+func nameSimilarity(a, b string) float64 {
+	ra, rb := normalizeHospitalName(a), normalizeHospitalName(b)
+	if string(ra) == string(rb) {
+		return 1
+	}
+	if len(ra) < 2 || len(rb) < 2 {
+		return 0
+	}
+
+	bigrams := make(map[string]int)
+	for i := 0; i+1 < len(ra); i++ {
+		bigrams[string(ra[i:i+2])]++
+	}
+
+	shared := 0
+	for i := 0; i+1 < len(rb); i++ {
+		bigram := string(rb[i : i+2])
+		if bigrams[bigram] > 0 {
+			bigrams[bigram]--
+			shared++
+		}
+	}
+
+	return 2 * float64(shared) / float64(len(ra)-1+len(rb)-1)
+}
+
+func normalizePhone(phone string) string {
+	var digits []rune
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	return string(digits)
+}
+
+// HospitalDuplicate is a hospital likely the same as another.
+type HospitalDuplicate struct {
+	Hospital   Hospital `json:"hospital"`
+	Distance   float64  `json:"distance"` // in Meters
+	Similarity float64  `json:"similarity"`
+	SamePhone  bool     `json:"same_phone"`
+}
+
+// FindDuplicates finds hospitals near i likely the same as i.
+func (i *Hospital) FindDuplicates() ([]HospitalDuplicate, error) {
+	if len(i.Location.Coordinates) < 2 {
+		return nil, nil
+	}
+
+	near := NearRequest{
+		Longitude: i.Location.Coordinates[0],
+		Latitude:  i.Location.Coordinates[1],
+		Distance:  duplicateDistance,
+	}
+	page := Page{Limit: geoNearLimit}
+	query := bson.M{"mergedinto": bson.M{"$exists": false}}
+	if i.Id.Valid() {
+		query["_id"] = bson.M{"$ne": i.Id}
+	}
+
+	var nearby []HospitalNearby
+	if err := dbcHospitals.Pipe(hospitalsNearPipeline(near, page, query)).All(&nearby); err != nil {
+		return nil, err
+	}
+
+	phone := normalizePhone(i.PhoneNumber)
+
+	var duplicates []HospitalDuplicate
+	for _, other := range nearby {
+		duplicate := HospitalDuplicate{
+			Hospital:   other.Hospital,
+			Distance:   other.Distance,
+			Similarity: nameSimilarity(i.Name, other.Name),
+			SamePhone:  phone != "" && phone == normalizePhone(other.PhoneNumber),
+		}
+
+		if duplicate.SamePhone || duplicate.Similarity >= duplicateSimilarity {
+			duplicates = append(duplicates, duplicate)
+		}
+	}
+	return duplicates, nil
+}
+
+// resolveHospitalId returns the id of the hospital id was merged into, or id
+// when not merged.
+func resolveHospitalId(id bson.ObjectId) bson.ObjectId {
+	for n := 0; n < maxMergeRedirects; n++ {
+		var hospital struct {
+			MergedInto bson.ObjectId `bson:"mergedinto,omitempty"`
+		}
+		if err := dbcHospitals.FindId(id).Select(bson.M{"mergedinto": 1}).One(&hospital); err != nil || hospital.MergedInto.Valid() == false {
+			return id
+		}
+		id = hospital.MergedInto
+	}
+	return id
+}
+
+// moveRelated points follows or bookmarks of the merged hospital to the
+// survivor. Users having both keep the one of the survivor.
+func moveRelated(merged, survivor bson.ObjectId, col *mgo.Collection, inUse func(userId bson.ObjectId) bool, remove func(id bson.ObjectId) error) {
+	var related []struct {
+		Id     bson.ObjectId `bson:"_id"`
+		UserId bson.ObjectId `bson:"userid"`
+	}
+	if err := col.Find(bson.M{"category": "hospital", "relatedid": merged}).All(&related); err != nil {
+		log.Print(err)
+		return
+	}
+
+	for _, doc := range related {
+		if inUse(doc.UserId) {
+			if err := remove(doc.Id); err != nil {
+				log.Print(err)
+			}
+			continue
+		}
+
+		if err := col.UpdateId(doc.Id, bson.M{"$set": bson.M{"relatedid": survivor}}); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// moveStaff points staff claims of the merged hospital to the survivor. Users
+// having claimed both keep the claim of the survivor, unless only the claim
+// of the merged hospital was approved.
+func moveStaff(merged, survivor bson.ObjectId) {
+	var claims []HospitalStaff
+	if err := dbcHospitalStaff.Find(bson.M{"hospitalid": merged}).All(&claims); err != nil {
+		log.Print(err)
+		return
+	}
+
+	for _, claim := range claims {
+		var kept HospitalStaff
+		err := dbcHospitalStaff.Find(bson.M{"userid": claim.UserId, "hospitalid": survivor}).One(&kept)
+		if err == nil {
+			if claim.Status != SubmissionApproved || kept.Status == SubmissionApproved {
+				if err := dbcHospitalStaff.RemoveId(claim.Id); err != nil {
+					log.Print(err)
+				}
+				continue
+			}
+			if err := dbcHospitalStaff.RemoveId(kept.Id); err != nil {
+				log.Print(err)
+				continue
+			}
+		} else if err != mgo.ErrNotFound {
+			log.Print(err)
+			continue
+		}
+
+		if err := dbcHospitalStaff.UpdateId(claim.Id, bson.M{"$set": bson.M{"hospitalid": survivor}}); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// MergeInto merges i into survivor. Reviews, likes, follows and bookmarks of
+// i are moved to survivor, and i is kept as a redirect to survivor.
+func (i *Hospital) MergeInto(survivor *Hospital) (err error) {
+	if i.Id == survivor.Id {
+		return errors.New("Cannot merge a hospital into itself.")
+	}
+
+	if _, err = dbcReviews.UpdateAll(
+		bson.M{"hospitalid": i.Id},
+		bson.M{"$set": bson.M{"hospitalid": survivor.Id}},
+	); err != nil {
+		return
+	}
+
+	if len(i.Likes) > 0 {
+		var change mgo.Change
+		change.Update = bson.M{"$addToSet": bson.M{"likes": bson.M{"$each": i.Likes}}}
+		change.ReturnNew = true
+		if _, err = dbcHospitals.FindId(survivor.Id).Apply(change, survivor); err != nil {
+			return
+		}
+		if err = dbcHospitals.UpdateId(survivor.Id, bson.M{"$set": bson.M{"likecount": len(survivor.Likes)}}); err != nil {
+			return
+		}
+	}
+
+	moveRelated(i.Id, survivor.Id, dbcFollows, func(userId bson.ObjectId) bool {
+		return isFollowing(userId, "hospital", survivor.Id)
+	}, func(id bson.ObjectId) error {
+		follow := Follow{}
+		if err := dbcFollows.FindId(id).One(&follow); err != nil {
+			return err
+		}
+		return follow.Delete()
+	})
+
+	moveRelated(i.Id, survivor.Id, dbcBookmarks, func(userId bson.ObjectId) bool {
+		n, err := dbcBookmarks.Find(bson.M{"userid": userId, "category": "hospital", "relatedid": survivor.Id}).Count()
+		return err == nil && n > 0
+	}, func(id bson.ObjectId) error {
+		bookmark := Bookmark{}
+		if err := dbcBookmarks.FindId(id).One(&bookmark); err != nil {
+			return err
+		}
+		return bookmark.Delete()
+	})
+
+	// Counts of the survivor from what was moved
+	for _, counted := range []struct {
+		col   *mgo.Collection
+		field string
+	}{
+		{dbcFollows, "followercount"},
+		{dbcBookmarks, "bookmarkcount"},
+	} {
+		n, err := counted.col.Find(bson.M{"category": "hospital", "relatedid": survivor.Id}).Count()
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		if err := dbcHospitals.UpdateId(survivor.Id, bson.M{"$set": bson.M{counted.field: n}}); err != nil {
+			log.Print(err)
+		}
+	}
+
+	moveStaff(i.Id, survivor.Id)
+
+	if _, err := dbcHospitalSubmissions.UpdateAll(
+		bson.M{"hospitalid": i.Id, "status": SubmissionPending},
+		bson.M{"$set": bson.M{"hospitalid": survivor.Id}},
+	); err != nil {
+		log.Print(err)
+	}
+
+	// Place id and registry id are unique. The survivor takes them when it
+	// has none.
+	unset := bson.M{"likes": "", "googleplaceid": "", "externalid": ""}
+	if err = dbcHospitals.UpdateId(i.Id, bson.M{
+		"$set":   bson.M{"mergedinto": survivor.Id, "merged": time.Now(), "likecount": 0, "followercount": 0, "bookmarkcount": 0},
+		"$unset": unset,
+	}); err != nil {
+		return
+	}
+	if i.GooglePlaceId != "" && survivor.GooglePlaceId == "" {
+		if err := dbcHospitals.UpdateId(survivor.Id, bson.M{"$set": bson.M{"googleplaceid": i.GooglePlaceId}}); err != nil {
+			log.Print(err)
+		}
+	}
+	if i.ExternalId != "" && survivor.ExternalId == "" {
+		if err := dbcHospitals.UpdateId(survivor.Id, bson.M{"$set": bson.M{"externalid": i.ExternalId, "imported": i.Imported}}); err != nil {
+			log.Print(err)
+		}
+	}
+
+	if len(i.Services) > 0 && len(survivor.Services) == 0 {
+		if err := dbcHospitals.UpdateId(survivor.Id, bson.M{"$set": bson.M{"services": i.Services}}); err != nil {
+			log.Print(err)
+		}
+	}
+
+	// Hospitals merged into i before now redirect to survivor.
+	if _, err := dbcHospitals.UpdateAll(
+		bson.M{"mergedinto": i.Id},
+		bson.M{"$set": bson.M{"mergedinto": survivor.Id}},
+	); err != nil {
+		log.Print(err)
+	}
+
+	updateHospitalRatings(survivor.Id)
+	return nil
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+// getHospitalDuplicates lists hospitals likely the same as the hospital to admins.
+func getHospitalDuplicates(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var hospital Hospital
+	if err := hospital.GetById(id); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	duplicates, err := hospital.FindDuplicates()
+	if err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"message":    "Successfully fetched Duplicates.",
+		"hospital":   hospital,
+		"duplicates": duplicates,
+	})
+}
+
+// getAllHospitalDuplicates scans a page of hospitals and lists those having
+// duplicates to admins. Each pair is listed once.
+func getAllHospitalDuplicates(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	page, err := getPageFromQuery(gc, DefaultPageLimit, SortKeyCreated, false)
+	if err != nil {
+		return
+	}
+
+	var hospitals []Hospital
+	query := page.Query(bson.M{"mergedinto": bson.M{"$exists": false}})
+	if err := dbcHospitals.Find(query).Sort(page.Sort()...).Limit(page.QueryLimit()).All(&hospitals); err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	hasMore := page.HasMore(len(hospitals))
+	nextCursor := ""
+	if hasMore {
+		hospitals = hospitals[:page.Limit]
+		last := hospitals[len(hospitals)-1]
+		nextCursor = NewCursor(last.Created, last.Id).Encode()
+	}
+
+	results := make([]gin.H, 0)
+	for _, hospital := range hospitals {
+		duplicates, err := hospital.FindDuplicates()
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+
+		var later []HospitalDuplicate
+		for _, duplicate := range duplicates {
+			if duplicate.Hospital.Id > hospital.Id {
+				later = append(later, duplicate)
+			}
+		}
+		if len(later) > 0 {
+			results = append(results, gin.H{"hospital": hospital, "duplicates": later})
+		}
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(results)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully fetched Duplicates.",
+		"duplicates":  results,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
+}
+
+// mergeHospital merges the hospital into the hospital of posted "into".
+func mergeHospital(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	intoStr := gc.PostForm("into")
+	if intoStr == "" {
+		MissingRequiredValue(gc, "into")
+		return
+	}
+	if bson.IsObjectIdHex(intoStr) == false {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid into."})
+		return
+	}
+
+	var merged, survivor Hospital
+	if err := dbcHospitals.FindId(id).One(&merged); err != nil {
+		DataNotFound(gc)
+		return
+	}
+	if merged.MergedInto.Valid() {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Already merged.", "mergedinto": merged.MergedInto})
+		return
+	}
+	if err := survivor.GetById(bson.ObjectIdHex(intoStr)); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	if err := merged.MergeInto(&survivor); err != nil {
+		log.Println(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	if err := survivor.GetById(survivor.Id); err != nil {
+		log.Print(err)
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":   0,
+		"message":  "Merged hospital.",
+		"hospital": survivor,
+	})
+}
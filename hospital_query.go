@@ -0,0 +1,312 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// HospitalNearby is a Hospital with its distance in meters from the queried point.
+type HospitalNearby struct {
+	Hospital `bson:",inline"`
+	Distance float64 `bson:"distance" json:"distance"`
+}
+
+// HospitalQuery builds the filter and order of a hospital list.
+type HospitalQuery struct {
+	Filter bson.M
+	Key    SortKey
+	Desc   bool
+	Near   *NearRequest
+	Box    *BoundingBox
+}
+
+func NewHospitalQuery() HospitalQuery {
+	return HospitalQuery{
+		Filter: bson.M{"mergedinto": bson.M{"$exists": false}},
+		Key:    SortKeyCreated,
+		Desc:   true,
+	}
+}
+
+func (hq *HospitalQuery) SetSort(sort string) error {
+	if strings.TrimPrefix(sort, "-") == "distance" {
+		if hq.Near == nil {
+			return errors.New("Sort by distance requires location")
+		}
+		hq.Key = sortKeyDistance
+		hq.Desc = false
+		return nil
+	}
+
+	key, desc, err := parseSort(sort, hospitalSortKeys)
+	if err != nil {
+		return err
+	}
+
+	hq.Key = key
+	hq.Desc = desc
+	return nil
+}
+
+// SetNear sorts hospitals by distance from near. Hospitals farther than
+// near.Distance meters are left out.
+func (hq *HospitalQuery) SetNear(near NearRequest) {
+	hq.Near = &near
+	hq.Key = sortKeyDistance
+	hq.Desc = false
+}
+
+// Within limits hospitals to the box. The circle of near.Distance does not
+// apply then.
+func (hq *HospitalQuery) Within(box BoundingBox) {
+	hq.Box = &box
+	hq.Filter["location"] = box.Query()
+}
+
+// Query returns the filter including location when not sorted by distance.
+func (hq *HospitalQuery) Query() bson.M {
+	if hq.Near == nil || hq.Key == sortKeyDistance || hq.Near.Distance <= 0 || hq.Box != nil {
+		return hq.Filter
+	}
+
+	query := bson.M{}
+	for k, v := range hq.Filter {
+		query[k] = v
+	}
+	query["location"] = bson.M{
+		"$geoWithin": bson.M{
+			"$centerSphere": []interface{}{
+				[]float64{hq.Near.Longitude, hq.Near.Latitude},
+				hq.Near.Distance / EarthRadius,
+			},
+		},
+	}
+	return query
+}
+
+// NamePrefix matches hospitals whose name starts with prefix.
+func (hq *HospitalQuery) NamePrefix(prefix string) {
+	hq.Filter["name"] = bson.RegEx{Pattern: "^" + regexp.QuoteMeta(prefix), Options: "i"}
+}
+
+// OpenAt matches hospitals open at t.
+func (hq *HospitalQuery) OpenAt(t time.Time) {
+	for k, v := range openAtQuery(t) {
+		hq.Filter[k] = v
+	}
+}
+
+// Region matches hospitals in the region named like "강남구".
+func (hq *HospitalQuery) Region(name string) {
+	for k, v := range regionQuery(name) {
+		hq.Filter[k] = v
+	}
+}
+
+func (hq *HospitalQuery) Species(petTypes []int) {
+	hq.Filter["species"] = bson.M{"$in": petTypes}
+}
+
+// Parse reads sort and filters from query string.
+// Responds on its own when a value is invalid.
+//
+//	sort         created, rating, rating_count or distance. "-" for descending.
+//	name         Name starts with
+//	region       Region like "강남구" or "서울 중구"
+//	open_now     true for hospitals open now
+//	24h          true for hospitals open 24 hours
+//	emergency    true for hospitals treating emergencies
+//	species      Comma separated pet types. Treats any.
+//	rating_min   Average rating
+//	latitude, longitude, distance   Distance in meters
+//	bbox         west,south,east,north of a map viewport. Instead of distance.
+func (hq *HospitalQuery) Parse(gc *gin.Context) (err error) {
+	defer func() {
+		if err != nil {
+			log.Print(err)
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		}
+	}()
+
+	if gc.Query("latitude") != "" || gc.Query("longitude") != "" {
+		var near NearRequest
+		if near.Latitude, err = queryFloat(gc, "latitude"); err != nil {
+			return
+		}
+		if near.Longitude, err = queryFloat(gc, "longitude"); err != nil {
+			return
+		}
+		if gc.Query("distance") != "" {
+			if near.Distance, err = queryFloat(gc, "distance"); err != nil {
+				return
+			}
+		}
+
+		hq.SetNear(near)
+	}
+
+	if str := gc.Query("bbox"); str != "" {
+		var box BoundingBox
+		if box, err = parseBoundingBox(str); err != nil {
+			return
+		}
+		hq.Within(box)
+	}
+
+	if sort := gc.Query("sort"); sort != "" {
+		if err = hq.SetSort(sort); err != nil {
+			return
+		}
+	}
+
+	if name := strings.TrimSpace(gc.Query("name")); name != "" {
+		hq.NamePrefix(name)
+	}
+
+	if region := strings.TrimSpace(gc.Query("region")); region != "" {
+		hq.Region(region)
+	}
+
+	if gc.Query("open_now") == "true" {
+		hq.OpenAt(time.Now())
+	}
+
+	if gc.Query("24h") == "true" {
+		hq.Filter["is24hours"] = true
+	}
+
+	if gc.Query("emergency") == "true" {
+		hq.Filter["hasemergency"] = true
+	}
+
+	if str := gc.Query("species"); str != "" {
+		var petTypes []int
+		for _, petTypeStr := range strings.Split(str, ",") {
+			petType, err := strconv.Atoi(petTypeStr)
+			if err != nil {
+				return errors.New("Invalid species.")
+			}
+			petTypes = append(petTypes, petType)
+		}
+		hq.Species(petTypes)
+	}
+
+	if gc.Query("rating_min") != "" {
+		var min float64
+		if min, err = queryFloat(gc, "rating_min"); err != nil {
+			return
+		}
+		hq.Filter["rating.average"] = bson.M{"$gte": min}
+	}
+
+	return nil
+}
+
+// hospitalsNearPipeline sorts hospitals matching query by distance from
+// posted location, up to posted.Distance meters, and returns the page after
+// the cursor.
+func hospitalsNearPipeline(posted NearRequest, page Page, query bson.M) []bson.M {
+	geoNear := bson.M{
+		"near": bson.M{
+			"type":        "Point",
+			"coordinates": []float64{posted.Longitude, posted.Latitude},
+		},
+		"distanceField": "distance",
+		"spherical":     true,
+		"query":         query,
+		"limit":         geoNearLimit,
+	}
+	if posted.Distance > 0 {
+		geoNear["maxDistance"] = posted.Distance
+	}
+
+	pipeline := []bson.M{{"$geoNear": geoNear}}
+	if page.HasCursor {
+		geoNear["minDistance"] = page.Cursor.Number
+		pipeline = append(pipeline, bson.M{"$match": page.DistanceMatch()})
+	}
+
+	return append(pipeline,
+		bson.M{"$sort": bson.D{{Name: "distance", Value: 1}, {Name: "_id", Value: 1}}},
+		bson.M{"$limit": page.QueryLimit()},
+	)
+}
+
+// listHospitals responds with a page of hospitals matching hq. Each hospital
+// has its distance in meters when hq is near a location.
+func listHospitals(gc *gin.Context, hq HospitalQuery, defaultLimit int, viewerId bson.ObjectId) {
+	page, err := getPageFromQuery(gc, defaultLimit, hq.Key, hq.Desc)
+	if err != nil {
+		return
+	}
+
+	var hospitals []HospitalNearby
+	if hq.Key == sortKeyDistance {
+		if err := dbcHospitals.Pipe(hospitalsNearPipeline(*hq.Near, page, hq.Query())).All(&hospitals); err != nil {
+			log.Print(err)
+			DatabaseError(gc)
+			return
+		}
+	} else {
+		if err := dbcHospitals.Find(page.Query(hq.Query())).Sort(page.Sort()...).Limit(page.QueryLimit()).All(&hospitals); err != nil {
+			log.Print(err)
+			DatabaseError(gc)
+			return
+		}
+
+		if hq.Near != nil {
+			for n := range hospitals {
+				hospitals[n].SetDistance(*hq.Near)
+			}
+		}
+	}
+
+	if len(hospitals) == 0 {
+		log.Print("No Hospitals")
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No hospitals.", "has_more": false})
+		return
+	}
+
+	hasMore := page.HasMore(len(hospitals))
+	nextCursor := ""
+	if hasMore {
+		hospitals = hospitals[:page.Limit]
+		last := hospitals[len(hospitals)-1]
+		if hq.Key == sortKeyDistance {
+			nextCursor = NewCursor(last.Distance, last.Id).Encode()
+		} else {
+			nextCursor = NewCursor(last.SortValue(page.Key), last.Id).Encode()
+		}
+	}
+
+	now := time.Now()
+	for n := range hospitals {
+		hospitals[n].SetLiked(viewerId)
+		hospitals[n].SetOpenStatus(now)
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(hospitals)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully fetched Hospitals.",
+		"hospitals":   hospitals,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
+}
+
+// SetDistance sets Distance from near.
+func (i *HospitalNearby) SetDistance(near NearRequest) {
+	if len(i.Location.Coordinates) < 2 {
+		return
+	}
+	i.Distance = distanceMeters(near.Latitude, near.Longitude, i.Location.Coordinates[1], i.Location.Coordinates[0])
+}
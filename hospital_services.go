@@ -0,0 +1,456 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Radius in meters of service search when location is given without distance.
+const serviceSearchDistance = 5000
+
+// ServiceType is a kind of service in the catalog. Costs reported in reviews
+// of its categories are compared with prices. See reviewCategories.
+type ServiceType struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+var serviceCatalog = []ServiceType{
+	{"consultation", "일반 진료"},
+	{"vaccination", "예방접종"},
+	{"heartworm", "심장사상충 예방"},
+	{"checkup", "건강검진"},
+	{"blood_test", "혈액검사"},
+	{"xray", "엑스레이"},
+	{"ultrasound", "초음파"},
+	{"scaling", "스케일링"},
+	{"neutering", "중성화 수술"},
+	{"patella", "슬개골 수술"},
+	{"microchip", "동물등록 칩"},
+}
+
+// Review categories of services besides their codes and names, as reviews
+// name them in free text.
+var serviceCategoryAliases = map[string][]string{
+	"consultation": {"진료", "일반진료", "외래"},
+	"vaccination":  {"접종", "백신", "종합백신"},
+	"heartworm":    {"심장사상충"},
+	"checkup":      {"검진", "종합검진"},
+	"blood_test":   {"피검사", "혈액 검사"},
+	"xray":         {"X-ray", "방사선"},
+	"scaling":      {"스켈링", "치석제거"},
+	"neutering":    {"중성화", "중성화수술"},
+	"patella":      {"슬개골", "슬개골탈구"},
+	"microchip":    {"동물등록", "마이크로칩"},
+}
+
+// reviewCategories returns categories of reviews about the service.
+func (t ServiceType) reviewCategories() []string {
+	return append([]string{t.Code, t.Name}, serviceCategoryAliases[t.Code]...)
+}
+
+func lookupServiceType(code string) (ServiceType, bool) {
+	for _, serviceType := range serviceCatalog {
+		if serviceType.Code == code {
+			return serviceType, true
+		}
+	}
+	return ServiceType{}, false
+}
+
+// HospitalService is a service a hospital advertises with its price range in
+// won. Name is of the catalog unless the hospital names it.
+type HospitalService struct {
+	Code     string    `bson:"code" json:"code"`
+	Name     string    `bson:"name" json:"name"`
+	Species  []int     `bson:"species,omitempty" json:"species,omitempty"` // Pet types. Any when empty.
+	PriceMin int       `bson:"pricemin" json:"price_min"`
+	PriceMax int       `bson:"pricemax" json:"price_max"`
+	Note     string    `bson:"note,omitempty" json:"note,omitempty"` // 체중 5kg 미만
+	Updated  time.Time `bson:"updated" json:"updated"`
+}
+
+func (i *HospitalService) Validate() error {
+	serviceType, ok := lookupServiceType(i.Code)
+	if ok == false {
+		return errors.New("Invalid service code: " + i.Code)
+	}
+
+	if strings.TrimSpace(i.Name) == "" {
+		i.Name = serviceType.Name
+	}
+	if i.PriceMax == 0 {
+		i.PriceMax = i.PriceMin
+	}
+	if i.PriceMin <= 0 || i.PriceMax < i.PriceMin {
+		return errors.New("Invalid price of service: " + i.Code)
+	}
+	return nil
+}
+
+// sameAs tells if the service is advertised the same as other.
+func (i *HospitalService) sameAs(other HospitalService) bool {
+	if len(i.Species) != len(other.Species) {
+		return false
+	}
+	for n := range i.Species {
+		if i.Species[n] != other.Species[n] {
+			return false
+		}
+	}
+	return i.Name == other.Name && i.PriceMin == other.PriceMin &&
+		i.PriceMax == other.PriceMax && i.Note == other.Note
+}
+
+// validateServices checks services and that each code is listed once.
+func validateServices(services []HospitalService) error {
+	codes := map[string]bool{}
+	for n := range services {
+		if err := services[n].Validate(); err != nil {
+			return err
+		}
+		if codes[services[n].Code] {
+			return errors.New("Duplicate service code: " + services[n].Code)
+		}
+		codes[services[n].Code] = true
+	}
+	return nil
+}
+
+// SetServices replaces the services of the hospital. A service keeps when it
+// was updated unless its price or details changed.
+func (i *Hospital) SetServices(services []HospitalService) (err error) {
+	if err = validateServices(services); err != nil {
+		return
+	}
+
+	now := time.Now()
+	for n := range services {
+		services[n].Updated = now
+		for _, old := range i.Services {
+			if old.Code == services[n].Code && services[n].sameAs(old) {
+				services[n].Updated = old.Updated
+			}
+		}
+	}
+
+	if err = dbcHospitals.UpdateId(i.Id, bson.M{"$set": bson.M{"services": services}}); err != nil {
+		return
+	}
+
+	i.Services = services
+	return nil
+}
+
+// reportedCosts returns statistics of costs reported in reviews matching
+// query, by groupField.
+func reportedCosts(query bson.M, groupField string) map[interface{}]CostStats {
+	rq := NewReviewQuery()
+	for k, v := range query {
+		rq.Filter[k] = v
+	}
+	rq.Range("cost", "$gt", 0)
+
+	stats, err := costStats(rq.Query(), groupField)
+	if err != nil {
+		log.Print(err)
+	}
+
+	costs := make(map[interface{}]CostStats, len(stats))
+	for _, stat := range stats {
+		costs[stat.Group] = stat
+	}
+	return costs
+}
+
+// HospitalServicePrice is a service of a hospital with the costs reported
+// in reviews of the hospital in the category of the service.
+type HospitalServicePrice struct {
+	HospitalService
+	Reported *CostStats `json:"reported,omitempty"`
+}
+
+// ServiceOffer is a service found in a search with the hospital offering it.
+type ServiceOffer struct {
+	HospitalId   bson.ObjectId   `bson:"_id" json:"hospitalid"`
+	HospitalName string          `bson:"name" json:"hospital_name"`
+	Address      string          `bson:"address" json:"address,omitempty"`
+	Location     GeoJson         `bson:"location" json:"location"`
+	Rating       HospitalRating  `bson:"rating" json:"rating"`
+	Service      HospitalService `bson:"services" json:"service"`
+	Distance     float64         `bson:"distance" json:"distance,omitempty"`
+	Reported     *CostStats      `bson:"-" json:"reported,omitempty"`
+	Hours        []OpeningHours  `bson:"hours" json:"-"`
+	Holidays     []HolidayHours  `bson:"holidays" json:"-"`
+	Is24Hours    bool            `bson:"is24hours" json:"-"`
+	IsOpen       bool            `bson:"-" json:"is_open"`
+	OpensAt      *time.Time      `bson:"-" json:"opens_at,omitempty"`  // When closed
+	ClosesAt     *time.Time      `bson:"-" json:"closes_at,omitempty"` // When open and not 24 hours
+}
+
+// SetOpenStatus sets IsOpen, and ClosesAt or OpensAt at t as of the hospital.
+func (o *ServiceOffer) SetOpenStatus(t time.Time) {
+	hospital := Hospital{Hours: o.Hours, Holidays: o.Holidays, Is24Hours: o.Is24Hours}
+	hospital.SetOpenStatus(t)
+	o.IsOpen, o.OpensAt, o.ClosesAt = hospital.IsOpen, hospital.OpensAt, hospital.ClosesAt
+}
+
+var sortKeyPrice = SortKey{Field: "services.pricemin"}
+
+// servicesPipeline unwinds services of hospitals matching hq.Query() and
+// returns the page of services matching service after the cursor.
+func servicesPipeline(hq HospitalQuery, service bson.M, page Page) []bson.M {
+	if page.Key == sortKeyDistance {
+		// One service of a code per hospital, so the page is of hospitals.
+		return append(hospitalsNearPipeline(*hq.Near, page, hq.Query()),
+			bson.M{"$unwind": "$services"},
+			bson.M{"$match": service},
+		)
+	}
+
+	order := 1
+	if page.Desc {
+		order = -1
+	}
+
+	return []bson.M{
+		{"$match": hq.Query()},
+		{"$unwind": "$services"},
+		{"$match": page.Query(service)},
+		{"$sort": bson.D{{Name: page.Key.Field, Value: order}, {Name: "_id", Value: order}}},
+		{"$limit": page.QueryLimit()},
+	}
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+// getServiceCatalog responds with the codes and names of services.
+func getServiceCatalog(gc *gin.Context) {
+	gc.JSON(http.StatusOK, gin.H{
+		"status":   0,
+		"message":  "Successfully fetched service catalog.",
+		"services": serviceCatalog,
+	})
+}
+
+// getHospitalServices responds with services of the hospital and the costs
+// reported in its reviews.
+func getHospitalServices(gc *gin.Context) {
+	loggedIn, _ := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var hospital Hospital
+	if err := hospital.GetById(id); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	services := make([]HospitalServicePrice, 0, len(hospital.Services))
+	for _, service := range hospital.Services {
+		price := HospitalServicePrice{HospitalService: service}
+		if serviceType, ok := lookupServiceType(service.Code); ok {
+			costs := reportedCosts(bson.M{
+				"hospitalid": hospital.Id,
+				"categories": bson.M{"$in": serviceType.reviewCategories()},
+			}, "")
+			if stats, ok := costs[nil]; ok {
+				price.Reported = &stats
+			}
+		}
+		services = append(services, price)
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"message":    "Successfully fetched Hospital Services.",
+		"hospitalid": hospital.Id,
+		"services":   services,
+	})
+}
+
+// updateHospitalServices replaces services of the hospital. Admins and staff
+// of the hospital edit them.
+func updateHospitalServices(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var hospital Hospital
+	if err := hospital.GetById(id); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	if isAdmin(myAccount) == false && isHospitalStaff(myAccount.Id, hospital.Id) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	var posted struct {
+		Services []HospitalService `json:"services"`
+	}
+	if err := gc.BindJSON(&posted); err != nil {
+		log.Println(err)
+		ErrorBinding(gc)
+		return
+	}
+
+	if err := hospital.SetServices(posted.Services); err != nil {
+		log.Println(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Updated services!", "services": hospital.Services})
+}
+
+// searchServices responds with a page of hospitals offering the service,
+// each with its price and the costs reported in its reviews.
+//
+//	code         Service code. Required.
+//	species      Pet type the service is for
+//	sort         price, -price or distance. price by default.
+//	latitude, longitude, distance   Distance in meters
+func searchServices(gc *gin.Context) {
+	loggedIn, _ := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	code := gc.Query("code")
+	serviceType, ok := lookupServiceType(code)
+	if ok == false {
+		MissingRequiredValue(gc, "code")
+		return
+	}
+
+	hq := NewHospitalQuery()
+	service := bson.M{"services.code": code}
+	offered := bson.M{"code": code}
+
+	if gc.Query("latitude") != "" || gc.Query("longitude") != "" {
+		near := NearRequest{Distance: serviceSearchDistance}
+		var err error
+		if near.Latitude, err = queryFloat(gc, "latitude"); err != nil {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+			return
+		}
+		if near.Longitude, err = queryFloat(gc, "longitude"); err != nil {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+			return
+		}
+		if gc.Query("distance") != "" {
+			if near.Distance, err = queryFloat(gc, "distance"); err != nil {
+				gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+				return
+			}
+		}
+		hq.SetNear(near)
+	}
+
+	if str := gc.Query("species"); str != "" {
+		petType, err := strconv.Atoi(str)
+		if err != nil {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid species."})
+			return
+		}
+		offered["$or"] = []bson.M{{"species": bson.M{"$exists": false}}, {"species": petType}}
+		service["$or"] = []bson.M{{"services.species": bson.M{"$exists": false}}, {"services.species": petType}}
+	}
+	hq.Filter["services"] = bson.M{"$elemMatch": offered}
+
+	switch gc.DefaultQuery("sort", "price") {
+	case "price":
+		hq.Key, hq.Desc = sortKeyPrice, false
+	case "-price":
+		hq.Key, hq.Desc = sortKeyPrice, true
+	case "distance":
+		if hq.Near == nil {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Sort by distance requires location"})
+			return
+		}
+		hq.Key, hq.Desc = sortKeyDistance, false
+	default:
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid sort: " + gc.Query("sort")})
+		return
+	}
+
+	page, err := getPageFromQuery(gc, DefaultPageLimit, hq.Key, hq.Desc)
+	if err != nil {
+		return
+	}
+
+	var offers []ServiceOffer
+	if err := dbcHospitals.Pipe(servicesPipeline(hq, service, page)).All(&offers); err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	if len(offers) == 0 {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No services.", "has_more": false})
+		return
+	}
+
+	hasMore := page.HasMore(len(offers))
+	nextCursor := ""
+	if hasMore {
+		offers = offers[:page.Limit]
+		last := offers[len(offers)-1]
+		if page.Key == sortKeyDistance {
+			nextCursor = NewCursor(last.Distance, last.HospitalId).Encode()
+		} else {
+			nextCursor = NewCursor(last.Service.PriceMin, last.HospitalId).Encode()
+		}
+	}
+
+	hospitalIds := make([]bson.ObjectId, 0, len(offers))
+	for _, offer := range offers {
+		hospitalIds = append(hospitalIds, offer.HospitalId)
+	}
+	costs := reportedCosts(bson.M{
+		"hospitalid": bson.M{"$in": hospitalIds},
+		"categories": bson.M{"$in": serviceType.reviewCategories()},
+	}, "hospitalid")
+
+	now := time.Now()
+	for n := range offers {
+		offers[n].SetOpenStatus(now)
+		if stats, ok := costs[offers[n].HospitalId]; ok {
+			offers[n].Reported = &stats
+		}
+		if hq.Near != nil && page.Key != sortKeyDistance && len(offers[n].Location.Coordinates) >= 2 {
+			offers[n].Distance = distanceMeters(hq.Near.Latitude, hq.Near.Longitude,
+				offers[n].Location.Coordinates[1], offers[n].Location.Coordinates[0])
+		}
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(offers)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully fetched services.",
+		"services":    offers,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const TableNameHospitalStaff = "hospitalstaff"
+
+var dbcHospitalStaff *mgo.Collection
+
+func init() {
+	const tableName = TableNameHospitalStaff
+	dbcHospitalStaff = dbSession.DB(dbName).C(tableName)
+	dbCols[tableName] = dbcHospitalStaff
+
+	index := mgo.Index{
+		Key:        []string{"userid", "hospitalid"},
+		Unique:     true,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	index = mgo.Index{
+		Key:        []string{"hospitalid", "status"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	index = mgo.Index{
+		Key:        []string{"status", "created"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+}
+
+// Types of notifications sent to hospital staff.
+const (
+	NotificationStaffReview   = "staff_review"   // Their hospital got a review
+	NotificationStaffApproved = "staff_approved" // Their claim was approved
+	NotificationStaffRejected = "staff_rejected" // Their claim was rejected or revoked
+)
+
+// HospitalStaff is a claim of a user working at a hospital. Admins verify
+// claims by the license number and proof, and approve them. Approved staff
+// respond to reviews of the hospital and edit its profile.
+type HospitalStaff struct {
+	Id            bson.ObjectId `bson:"_id" json:"id"`
+	UserId        bson.ObjectId `json:"userid"`
+	HospitalId    bson.ObjectId `json:"hospitalid"`
+	Position      string        `json:"position"`                                   // 원장, 수의사
+	LicenseNumber string        `bson:",omitempty" json:"license_number,omitempty"` // 수의사 면허번호
+	ProofImageId  bson.ObjectId `bson:",omitempty" json:"proof_imageid,omitempty"`  // Image of the license or business registration
+	Status        string        `json:"status"`                                     // pending, approved or rejected
+	Note          string        `bson:",omitempty" json:"note,omitempty"`           // From the admin
+	ReviewerId    bson.ObjectId `bson:",omitempty" json:"-"`                        // Admin who approved or rejected
+	Reviewed      time.Time     `bson:",omitempty" json:"reviewed,omitempty"`       // Approved or rejected
+	Created       time.Time     `json:"created"`
+}
+
+// OfficialResponse is the response of a hospital to a review. A review has
+// one at most, shown apart from comments.
+type OfficialResponse struct {
+	HospitalId bson.ObjectId `json:"hospitalid"`
+	UserId     bson.ObjectId `json:"-"` // Staff who wrote it
+	Body       string        `json:"body"`
+	IsEdited   bool          `json:"isedited"`
+	Edited     time.Time     `bson:",omitempty" json:"edited,omitempty"`
+	Created    time.Time     `json:"created"`
+}
+
+////////////////////////      BASIC OPERATIONS     ///////////////////////////
+
+func (i *HospitalStaff) Insert() (bson.ObjectId, error) {
+	if i.Id.Valid() == false {
+		i.Id = bson.NewObjectId()
+	}
+	i.Status = SubmissionPending
+	i.Created = time.Now()
+
+	if err := dbcHospitalStaff.Insert(&i); err != nil {
+		log.Println("Could not insert a hospital staff.")
+		return i.Id, err
+	}
+
+	return i.Id, nil
+}
+
+func (i *HospitalStaff) Update() (err error) {
+	if i.Id.Valid() == false {
+		return errors.New("Invalid HospitalStaff Id")
+	}
+
+	return dbcHospitalStaff.UpdateId(i.Id, &i)
+}
+
+func (i *HospitalStaff) GetById(id bson.ObjectId) (err error) {
+	return dbcHospitalStaff.FindId(id).One(&i)
+}
+
+// Approve verifies the claim and makes the user staff.
+func (i *HospitalStaff) Approve(reviewerId bson.ObjectId) (err error) {
+	i.Status = SubmissionApproved
+	i.ReviewerId = reviewerId
+	i.Reviewed = time.Now()
+	if err = i.Update(); err != nil {
+		return
+	}
+
+	return dbcUsers.Update(
+		bson.M{"_id": i.UserId, "usergroup": UserGroupNormal},
+		bson.M{"$set": bson.M{"usergroup": UserGroupStaff}},
+	)
+}
+
+// Reject rejects the claim, or revokes it when approved. The user is no
+// longer staff when working at no other hospital.
+func (i *HospitalStaff) Reject(reviewerId bson.ObjectId, note string) (err error) {
+	i.Status = SubmissionRejected
+	i.Note = note
+	i.ReviewerId = reviewerId
+	i.Reviewed = time.Now()
+	if err = i.Update(); err != nil {
+		return
+	}
+
+	if n, err := dbcHospitalStaff.Find(bson.M{"userid": i.UserId, "status": SubmissionApproved}).Count(); err != nil || n > 0 {
+		return err
+	}
+
+	if err = dbcUsers.Update(
+		bson.M{"_id": i.UserId, "usergroup": UserGroupStaff},
+		bson.M{"$set": bson.M{"usergroup": UserGroupNormal}},
+	); err == mgo.ErrNotFound {
+		return nil
+	}
+	return
+}
+
+// notifyClaimer tells the user the claim was approved or rejected.
+func (i *HospitalStaff) notifyClaimer() {
+	notificationType := NotificationStaffApproved
+	if i.Status == SubmissionRejected {
+		notificationType = NotificationStaffRejected
+	}
+
+	var hospital Hospital
+	if err := hospital.GetById(i.HospitalId); err != nil {
+		log.Print(err)
+		return
+	}
+
+	notification := Notification{
+		Id:          bson.NewObjectId(), // Insert a new Notification
+		UserId:      i.UserId,           // Claimer sees this notification
+		Type:        notificationType,
+		Message:     hospital.Name,
+		RelatedType: "hospital",
+		RelatedId:   hospital.Id,
+		IsRead:      false, // It's new and not read.
+		IsSent:      false,
+	}
+
+	if _, err := notification.Insert(); err != nil {
+		log.Print(err)
+	}
+}
+
+// isHospitalStaff tells if the user is approved staff of the hospital.
+func isHospitalStaff(userId bson.ObjectId, hospitalId bson.ObjectId) bool {
+	n, err := dbcHospitalStaff.Find(bson.M{
+		"userid":     userId,
+		"hospitalid": hospitalId,
+		"status":     SubmissionApproved,
+	}).Count()
+	if err != nil {
+		log.Print(err)
+	}
+	return n > 0
+}
+
+// staffIds returns ids of approved staff of the hospital.
+func staffIds(hospitalId bson.ObjectId) []bson.ObjectId {
+	var staff []HospitalStaff
+	if err := dbcHospitalStaff.Find(bson.M{"hospitalid": hospitalId, "status": SubmissionApproved}).All(&staff); err != nil {
+		log.Print(err)
+	}
+
+	ids := make([]bson.ObjectId, 0, len(staff))
+	for _, member := range staff {
+		ids = append(ids, member.UserId)
+	}
+	return ids
+}
+
+// Respond sets the response of the hospital to the review. Responding again
+// edits the response.
+func (i *Review) Respond(userId bson.ObjectId, body string) (err error) {
+	now := time.Now()
+	response := OfficialResponse{
+		HospitalId: i.HospitalId,
+		UserId:     userId,
+		Body:       body,
+		Created:    now,
+	}
+	if i.Response != nil {
+		response.Created = i.Response.Created
+		response.IsEdited = true
+		response.Edited = now
+	}
+
+	if err = dbcReviews.UpdateId(i.Id, bson.M{"$set": bson.M{"response": response}}); err != nil {
+		return
+	}
+
+	i.Response = &response
+	return nil
+}
+
+func (i *Review) DeleteResponse() (err error) {
+	if err = dbcReviews.UpdateId(i.Id, bson.M{"$unset": bson.M{"response": ""}}); err != nil {
+		return
+	}
+
+	i.Response = nil
+	return nil
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+// claimHospital asks admins to verify the user works at the hospital.
+func claimHospital(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var hospital Hospital
+	if err := hospital.GetById(id); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	var posted HospitalStaff
+	if err := gc.BindJSON(&posted); err != nil {
+		log.Println(err)
+		ErrorBinding(gc)
+		return
+	}
+
+	if strings.TrimSpace(posted.Position) == "" || strings.TrimSpace(posted.LicenseNumber) == "" {
+		MissingRequiredValue(gc, "position", "license_number")
+		return
+	}
+
+	claim := HospitalStaff{
+		UserId:        myAccount.Id,
+		HospitalId:    hospital.Id,
+		Position:      strings.TrimSpace(posted.Position),
+		LicenseNumber: strings.TrimSpace(posted.LicenseNumber),
+		ProofImageId:  posted.ProofImageId,
+	}
+
+	if _, err := claim.Insert(); mgo.IsDup(err) {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Already claimed."})
+		return
+
+	} else if err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":  0,
+		"message": "Claimed. An admin will verify it.",
+		"claim":   claim,
+	})
+}
+
+// listHospitalStaff responds with a page of claims matching query.
+func listHospitalStaff(gc *gin.Context, query bson.M, desc bool) {
+	page, err := getPageFromQuery(gc, DefaultPageLimit, SortKeyCreated, desc)
+	if err != nil {
+		return
+	}
+
+	var claims []HospitalStaff
+	if err := dbcHospitalStaff.Find(page.Query(query)).Sort(page.Sort()...).Limit(page.QueryLimit()).All(&claims); err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	hasMore := page.HasMore(len(claims))
+	nextCursor := ""
+	if hasMore {
+		claims = claims[:page.Limit]
+		last := claims[len(claims)-1]
+		nextCursor = NewCursor(last.Created, last.Id).Encode()
+	}
+
+	results := make([]gin.H, 0, len(claims))
+	for _, claim := range claims {
+		var hospital Hospital
+		if err := hospital.GetById(claim.HospitalId); err != nil {
+			continue
+		}
+		results = append(results, gin.H{"claim": claim, "hospital": hospital})
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(results)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully fetched Hospital Claims.",
+		"claims":      results,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
+}
+
+// getHospitalClaims lists claims to admins, oldest first. "status" in query
+// is pending unless given.
+func getHospitalClaims(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	listHospitalStaff(gc, bson.M{"status": gc.DefaultQuery("status", SubmissionPending)}, false)
+}
+
+func getMyHospitalClaims(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	listHospitalStaff(gc, bson.M{"userid": myAccount.Id}, true)
+}
+
+// reviewHospitalClaim approves a pending claim, or rejects a pending or
+// approved one, and notifies the claimer.
+func reviewHospitalClaim(gc *gin.Context, approve bool) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var claim HospitalStaff
+	if err := claim.GetById(id); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	if (approve && claim.Status != SubmissionPending) || claim.Status == SubmissionRejected {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Already " + claim.Status + "."})
+		return
+	}
+
+	if approve {
+		err = claim.Approve(myAccount.Id)
+	} else {
+		err = claim.Reject(myAccount.Id, gc.PostForm("note"))
+	}
+	if err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	go claim.notifyClaimer()
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":  0,
+		"message": "Claim " + claim.Status + ".",
+		"claim":   claim,
+	})
+}
+
+func approveHospitalClaim(gc *gin.Context) {
+	reviewHospitalClaim(gc, true)
+}
+
+func rejectHospitalClaim(gc *gin.Context) {
+	reviewHospitalClaim(gc, false)
+}
+
+// getStaffReview finds the review of id at a hospital the user is staff of.
+// Responds on its own when not found or not staff.
+func getStaffReview(gc *gin.Context, userId bson.ObjectId) (review Review, ok bool) {
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return review, false
+	}
+
+	if err := review.GetById(id); err != nil || review.IsDeleted || review.IsDraft {
+		DataNotFound(gc)
+		return review, false
+	}
+
+	if review.HospitalId.Valid() == false || isHospitalStaff(userId, review.HospitalId) == false {
+		NotAuthorized(gc)
+		return review, false
+	}
+
+	return review, true
+}
+
+// respondReview posts or edits the official response to a review.
+func respondReview(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	review, ok := getStaffReview(gc, myAccount.Id)
+	if ok == false {
+		return
+	}
+
+	body := strings.TrimSpace(gc.PostForm("body"))
+	if body == "" {
+		MissingRequiredValue(gc, "body")
+		return
+	}
+
+	if err := review.Respond(myAccount.Id, body); err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Responded!", "response": review.Response})
+}
+
+func deleteReviewResponse(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	review, ok := getStaffReview(gc, myAccount.Id)
+	if ok == false {
+		return
+	}
+
+	if review.Response == nil {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No response."})
+		return
+	}
+
+	if err := review.DeleteResponse(); err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Deleted response."})
+}
+
+// updateStaffHospital edits the profile of the hospital by its staff.
+func updateStaffHospital(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var hospital Hospital
+	if err := hospital.GetById(id); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	if isHospitalStaff(myAccount.Id, hospital.Id) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	posted, fields, ok := bindHospitalEdit(gc)
+	if ok == false {
+		return
+	}
+
+	posted.Location.Type = "Point"
+	if err := posted.Validate(); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	hospital.applyEdit(&posted, fields)
+	if err := hospital.saveEdit(); err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Updated hospital!", "hospital": hospital})
+}
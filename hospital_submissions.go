@@ -0,0 +1,544 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const TableNameHospitalSubmissions = "hospitalsubmissions"
+
+var dbcHospitalSubmissions *mgo.Collection
+
+func init() {
+	const tableName = TableNameHospitalSubmissions
+	dbcHospitalSubmissions = dbSession.DB(dbName).C(tableName)
+	dbCols[tableName] = dbcHospitalSubmissions
+
+	index := mgo.Index{
+		Key:        []string{"status", "created"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	index = mgo.Index{
+		Key:        []string{"userid", "-created"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+}
+
+// Status of a submission.
+const (
+	SubmissionPending  = "pending"
+	SubmissionApproved = "approved"
+	SubmissionRejected = "rejected"
+)
+
+// Types of notifications sent to the submitter.
+const (
+	NotificationSubmissionApproved = "hospital_submission_approved"
+	NotificationSubmissionRejected = "hospital_submission_rejected"
+)
+
+// HospitalSubmission is a new hospital or an edit of a hospital suggested by
+// a user. Admins approve it to write it to hospitals.
+type HospitalSubmission struct {
+	Id         bson.ObjectId `bson:"_id" json:"id"`
+	UserId     bson.ObjectId `json:"userid"`                                 // Submitter
+	HospitalId bson.ObjectId `bson:",omitempty" json:"hospitalid,omitempty"` // Edited hospital. Set on approval of new one.
+	Hospital   Hospital      `json:"hospital"`                               // Proposed hospital
+	Fields     []string      `bson:",omitempty" json:"fields,omitempty"`     // Proposed fields of an edit. All when empty.
+	Status     string        `json:"status"`                                 // pending, approved or rejected
+	Note       string        `bson:",omitempty" json:"note,omitempty"`       // From the admin
+	ReviewerId bson.ObjectId `bson:",omitempty" json:"-"`                    // Admin who approved or rejected
+	Reviewed   time.Time     `bson:",omitempty" json:"reviewed,omitempty"`   // Approved or rejected
+	Changes    []FieldChange `bson:"-" json:"changes,omitempty"`             // From the hospital as it is now
+	Created    time.Time     `json:"created"`
+}
+
+// FieldChange is a field of a hospital changed by a submission.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// Fields of hospitals users can submit by their JSON names. Other fields are
+// kept by the server.
+var hospitalEditableFields = []struct {
+	name  string
+	value func(h *Hospital) interface{}
+	set   func(h, edit *Hospital)
+}{
+	{"name", func(h *Hospital) interface{} { return h.Name }, func(h, edit *Hospital) { h.Name = edit.Name }},
+	{"location", func(h *Hospital) interface{} { return h.Location }, func(h, edit *Hospital) { h.Location = edit.Location }},
+	{"address", func(h *Hospital) interface{} { return h.Address }, func(h, edit *Hospital) { h.Address = edit.Address }},
+	{"phone_number", func(h *Hospital) interface{} { return h.PhoneNumber }, func(h, edit *Hospital) { h.PhoneNumber = edit.PhoneNumber }},
+	{"contact_info", func(h *Hospital) interface{} { return h.ContactInfo }, func(h, edit *Hospital) { h.ContactInfo = edit.ContactInfo }},
+	{"extra_info", func(h *Hospital) interface{} { return h.ExtraInfo }, func(h, edit *Hospital) { h.ExtraInfo = edit.ExtraInfo }},
+	{"hours", func(h *Hospital) interface{} { return h.Hours }, func(h, edit *Hospital) { h.Hours = edit.Hours }},
+	{"holidays", func(h *Hospital) interface{} { return h.Holidays }, func(h, edit *Hospital) { h.Holidays = edit.Holidays }},
+	{"is24hours", func(h *Hospital) interface{} { return h.Is24Hours }, func(h, edit *Hospital) { h.Is24Hours = edit.Is24Hours }},
+	{"has_emergency", func(h *Hospital) interface{} { return h.HasEmergency }, func(h, edit *Hospital) { h.HasEmergency = edit.HasEmergency }},
+	{"species", func(h *Hospital) interface{} { return h.Species }, func(h, edit *Hospital) { h.Species = edit.Species }},
+}
+
+// hasField tells if field is in fields. Every field is in nil fields.
+func hasField(fields []string, field string) bool {
+	if fields == nil {
+		return true
+	}
+	for _, name := range fields {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// bindHospitalEdit binds the posted hospital and returns the editable fields
+// posted, so that fields left out are kept. Responds on its own when invalid.
+func bindHospitalEdit(gc *gin.Context) (posted Hospital, fields []string, ok bool) {
+	body, err := ioutil.ReadAll(gc.Request.Body)
+	if err != nil {
+		log.Println(err)
+		ErrorBinding(gc)
+		return posted, nil, false
+	}
+
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(body, &posted); err != nil {
+		log.Println(err)
+		ErrorBinding(gc)
+		return posted, nil, false
+	}
+	if err := json.Unmarshal(body, &keys); err != nil {
+		log.Println(err)
+		ErrorBinding(gc)
+		return posted, nil, false
+	}
+
+	// Name and location are kept when empty. See applyEdit.
+	if posted.Name == "" {
+		delete(keys, "name")
+	}
+	if len(posted.Location.Coordinates) < 2 {
+		delete(keys, "location")
+	}
+
+	fields = []string{}
+	for _, field := range hospitalEditableFields {
+		if _, ok := keys[field.name]; ok {
+			fields = append(fields, field.name)
+		}
+	}
+	return posted, fields, true
+}
+
+// hospitalChanges lists editable fields in fields differing between old and
+// new. Nil fields are all.
+func hospitalChanges(old, new *Hospital, fields []string) []FieldChange {
+	var changes []FieldChange
+	for _, field := range hospitalEditableFields {
+		if hasField(fields, field.name) == false {
+			continue
+		}
+		oldValue, newValue := field.value(old), field.value(new)
+		if reflect.DeepEqual(oldValue, newValue) == false {
+			changes = append(changes, FieldChange{Field: field.name, Old: oldValue, New: newValue})
+		}
+	}
+	return changes
+}
+
+// changedFields returns the fields in fields changed from old to new.
+func changedFields(old, new *Hospital, fields []string) []string {
+	changed := []string{}
+	for _, change := range hospitalChanges(old, new, fields) {
+		changed = append(changed, change.Field)
+	}
+	return changed
+}
+
+// applyEdit copies editable fields in fields of edit to i. Nil fields are
+// all. Name and location are kept when empty in edit.
+func (i *Hospital) applyEdit(edit *Hospital, fields []string) {
+	for _, field := range hospitalEditableFields {
+		if hasField(fields, field.name) == false {
+			continue
+		}
+		if field.name == "name" && edit.Name == "" {
+			continue
+		}
+		if field.name == "location" && len(edit.Location.Coordinates) < 2 {
+			continue
+		}
+		field.set(i, edit)
+	}
+	i.Updated = time.Now()
+}
+
+////////////////////////      BASIC OPERATIONS     ///////////////////////////
+
+func (i *HospitalSubmission) Insert() (bson.ObjectId, error) {
+	if i.Id.Valid() == false {
+		i.Id = bson.NewObjectId()
+	}
+	i.Status = SubmissionPending
+	i.Created = time.Now()
+
+	if err := dbcHospitalSubmissions.Insert(&i); err != nil {
+		log.Println("Could not insert a hospital submission.")
+		return i.Id, err
+	}
+
+	return i.Id, nil
+}
+
+func (i *HospitalSubmission) Update() (err error) {
+	if i.Id.Valid() == false {
+		return errors.New("Invalid HospitalSubmission Id")
+	}
+
+	return dbcHospitalSubmissions.UpdateId(i.Id, &i)
+}
+
+func (i *HospitalSubmission) GetById(id bson.ObjectId) (err error) {
+	return dbcHospitalSubmissions.FindId(id).One(&i)
+}
+
+// editFields returns the fields the submission proposes, or nil for all.
+func (i *HospitalSubmission) editFields() []string {
+	if i.HospitalId.Valid() == false || len(i.Fields) == 0 {
+		return nil
+	}
+	return i.Fields
+}
+
+// SetChanges sets Changes from the hospital as it is now. A new hospital
+// has all its fields changed.
+func (i *HospitalSubmission) SetChanges() {
+	var current Hospital
+	if i.HospitalId.Valid() {
+		if err := current.GetById(i.HospitalId); err != nil {
+			log.Print(err)
+		}
+	}
+	i.Changes = hospitalChanges(&current, &i.Hospital, i.editFields())
+}
+
+var ErrAlreadyReviewed = errors.New("Already reviewed.")
+
+// review sets the status of the submission when it is still pending, so that
+// only one admin approves or rejects it.
+func (i *HospitalSubmission) review(status string, reviewerId bson.ObjectId, note string) error {
+	now := time.Now()
+	if err := dbcHospitalSubmissions.Update(
+		bson.M{"_id": i.Id, "status": SubmissionPending},
+		bson.M{"$set": bson.M{"status": status, "reviewerid": reviewerId, "reviewed": now, "note": note}},
+	); err == mgo.ErrNotFound {
+		return ErrAlreadyReviewed
+	} else if err != nil {
+		return err
+	}
+
+	i.Status = status
+	i.ReviewerId = reviewerId
+	i.Reviewed = now
+	i.Note = note
+	return nil
+}
+
+// Approve writes the submission to hospitals. Only editable fields are
+// written.
+func (i *HospitalSubmission) Approve(reviewerId bson.ObjectId) (err error) {
+	if err = i.review(SubmissionApproved, reviewerId, ""); err != nil {
+		return
+	}
+
+	if err = i.write(); err != nil {
+		// Pending again for another try
+		if err := dbcHospitalSubmissions.UpdateId(i.Id, bson.M{
+			"$set":   bson.M{"status": SubmissionPending},
+			"$unset": bson.M{"reviewerid": "", "reviewed": ""},
+		}); err != nil {
+			log.Print(err)
+		}
+		i.Status = SubmissionPending
+		return
+	}
+	return nil
+}
+
+func (i *HospitalSubmission) write() (err error) {
+	if i.HospitalId.Valid() {
+		var hospital Hospital
+		if err = hospital.GetById(i.HospitalId); err != nil {
+			return
+		}
+
+		hospital.applyEdit(&i.Hospital, i.editFields())
+		return hospital.saveEdit()
+	}
+
+	var hospital Hospital
+	hospital.applyEdit(&i.Hospital, nil)
+	hospital.SubmittedBy = i.UserId
+	if err = hospital.Insert(); err != nil {
+		return
+	}
+
+	i.HospitalId = hospital.Id
+	return dbcHospitalSubmissions.UpdateId(i.Id, bson.M{"$set": bson.M{"hospitalid": hospital.Id}})
+}
+
+func (i *HospitalSubmission) Reject(reviewerId bson.ObjectId, note string) (err error) {
+	return i.review(SubmissionRejected, reviewerId, note)
+}
+
+// notifySubmitter tells the submitter the submission was approved or rejected.
+func (i *HospitalSubmission) notifySubmitter() {
+	notificationType := NotificationSubmissionApproved
+	relatedType, relatedId := "hospital", i.HospitalId
+	if i.Status == SubmissionRejected {
+		notificationType = NotificationSubmissionRejected
+		relatedType, relatedId = "hospital_submission", i.Id
+	}
+
+	notification := Notification{
+		Id:          bson.NewObjectId(), // Insert a new Notification
+		UserId:      i.UserId,           // Submitter sees this notification
+		Type:        notificationType,
+		Message:     i.Hospital.Name,
+		RelatedType: relatedType,
+		RelatedId:   relatedId,
+		IsRead:      false, // It's new and not read.
+		IsSent:      false,
+	}
+
+	if _, err := notification.Insert(); err != nil {
+		log.Print(err)
+	}
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+// submitHospital queues a new hospital for admins to approve. Posting a
+// hospital id in the url suggests an edit of the hospital instead.
+func submitHospital(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	posted, fields, ok := bindHospitalEdit(gc)
+	if ok == false {
+		return
+	}
+
+	posted.Location.Type = "Point"
+	if err := posted.Validate(); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	submission := HospitalSubmission{UserId: myAccount.Id}
+	var proposal Hospital
+
+	if gc.Param("id") != "" {
+		id, err := getIdFromParam(gc)
+		if err != nil {
+			return
+		}
+
+		var hospital Hospital
+		if err := hospital.GetById(id); err != nil {
+			DataNotFound(gc)
+			return
+		}
+
+		// Only posted fields are proposed. Others are kept as they are.
+		fields = changedFields(&hospital, &posted, fields)
+		if len(fields) == 0 {
+			gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Nothing changed."})
+			return
+		}
+
+		submission.HospitalId = hospital.Id
+		submission.Fields = fields
+		proposal.Id = hospital.Id
+		proposal.Name = hospital.Name
+		proposal.Location = hospital.Location
+	} else {
+		if posted.Name == "" {
+			MissingRequiredValue(gc, "name")
+			return
+		}
+		proposal.Id = bson.NewObjectId()
+		fields = nil
+	}
+
+	// Only editable fields are proposed. Others are kept by the server.
+	proposal.applyEdit(&posted, fields)
+	submission.Hospital = proposal
+
+	if _, err := submission.Insert(); err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"message":    "Submitted. An admin will review it.",
+		"submission": submission,
+	})
+}
+
+// listHospitalSubmissions responds with a page of submissions matching query,
+// each with its changes from the hospital as it is now.
+func listHospitalSubmissions(gc *gin.Context, query bson.M, desc bool) {
+	page, err := getPageFromQuery(gc, DefaultPageLimit, SortKeyCreated, desc)
+	if err != nil {
+		return
+	}
+
+	var submissions []HospitalSubmission
+	if err := dbcHospitalSubmissions.Find(page.Query(query)).Sort(page.Sort()...).Limit(page.QueryLimit()).All(&submissions); err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	hasMore := page.HasMore(len(submissions))
+	nextCursor := ""
+	if hasMore {
+		submissions = submissions[:page.Limit]
+		last := submissions[len(submissions)-1]
+		nextCursor = NewCursor(last.Created, last.Id).Encode()
+	}
+
+	for n := range submissions {
+		if submissions[n].Status == SubmissionPending {
+			submissions[n].SetChanges()
+		}
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(submissions)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully fetched Hospital Submissions.",
+		"submissions": submissions,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
+}
+
+// getHospitalSubmissions lists submissions to admins, oldest first.
+// "status" in query is pending unless given.
+func getHospitalSubmissions(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	listHospitalSubmissions(gc, bson.M{"status": gc.DefaultQuery("status", SubmissionPending)}, false)
+}
+
+func getMyHospitalSubmissions(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	listHospitalSubmissions(gc, bson.M{"userid": myAccount.Id}, true)
+}
+
+// reviewHospitalSubmission approves or rejects a pending submission and
+// notifies the submitter.
+func reviewHospitalSubmission(gc *gin.Context, approve bool) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var submission HospitalSubmission
+	if err := submission.GetById(id); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	if submission.Status != SubmissionPending {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Already " + submission.Status + "."})
+		return
+	}
+
+	if approve {
+		err = submission.Approve(myAccount.Id)
+	} else {
+		err = submission.Reject(myAccount.Id, gc.PostForm("note"))
+	}
+	if err == ErrAlreadyReviewed {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": err.Error()})
+		return
+	} else if err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	go submission.notifySubmitter()
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":     0,
+		"message":    "Submission " + submission.Status + ".",
+		"submission": submission,
+	})
+}
+
+func approveHospitalSubmission(gc *gin.Context) {
+	reviewHospitalSubmission(gc, true)
+}
+
+func rejectHospitalSubmission(gc *gin.Context) {
+	reviewHospitalSubmission(gc, false)
+}
@@ -1,11 +1,9 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -47,6 +45,75 @@ func init() {
 		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
 		panic(err)
 	}
+
+	index = mgo.Index{
+		Key:        []string{"externalid"},
+		Unique:     true,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	if err := dbCols[tableName].EnsureIndex(searchTextIndex); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	index = mgo.Index{
+		Key:        []string{"region.names"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	index = mgo.Index{
+		Key:        []string{"services.code", "services.pricemin"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	for _, key := range []string{"rating.average", "rating.count"} {
+		index = mgo.Index{
+			Key:        []string{key, "_id"},
+			Unique:     false,
+			DropDups:   false,
+			Background: true,
+			Sparse:     false,
+		}
+
+		if err := dbCols[tableName].EnsureIndex(index); err != nil {
+			log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+			panic(err)
+		}
+	}
+
+	backfillLikeCount(dbcHospitals)
+	backfillHospitalRatings()
+}
+
+// Sortable fields of hospitals. Keys are the values accepted in "sort".
+var hospitalSortKeys = map[string]SortKey{
+	"created":      SortKeyCreated,
+	"rating":       {Field: "rating.average"},
+	"rating_count": {Field: "rating.count"},
 }
 
 // Address similar as in android.location.Address Java Package
@@ -56,11 +123,33 @@ type Hospital struct {
 	Name          string            `bson:"name" json:"name"`
 	Location      GeoJson           `bson:"location" json:"location"`
 	Address       string            `bson:",omitempty" json:"address,omitempty"`
+	Region        *Region           `bson:"region,omitempty" json:"region,omitempty"` // Of Location
 	PhoneNumber   string            `bson:",omitempty" json:"phone_number,omitempty"`
 	ContactInfo   map[string]string `bson:",omitempty" json:"contact_info,omitempty"`
 	ExtraInfo     map[string]string `bson:",omitempty" json:"extra_info,omitempty"`
 	GooglePlaceId string            `bson:"googleplaceid,omitempty" json:"placeid,omitempty"`
-	Likes         []bson.ObjectId   `json:"likes,omitempty"`
+	Hours         []OpeningHours    `bson:"hours,omitempty" json:"hours,omitempty"`
+	Holidays      []HolidayHours    `bson:"holidays,omitempty" json:"holidays,omitempty"` // Overrides Hours on the dates
+	Is24Hours     bool              `bson:"is24hours" json:"is24hours"`
+	HasEmergency  bool              `bson:"hasemergency" json:"has_emergency"`
+	Species       []int             `bson:"species,omitempty" json:"species,omitempty"`   // Pet types treated
+	Services      []HospitalService `bson:"services,omitempty" json:"services,omitempty"` // Price list
+	Rating        HospitalRating    `bson:"rating" json:"rating"`
+	Likes         []bson.ObjectId   `json:"-"`
+	LikeCount     int               `bson:"likecount" json:"like_count"`
+	Liked         bool              `bson:"-" json:"liked"` // Liked by who requested
+	BookmarkCount int               `bson:"bookmarkcount" json:"bookmark_count"`
+	FollowerCount int               `bson:"followercount" json:"follower_count"`
+	Followed      bool              `bson:"-" json:"followed"` // Followed by who requested
+	IsOpen        bool              `bson:"-" json:"is_open"`
+	OpensAt       *time.Time        `bson:"-" json:"opens_at,omitempty"`  // When closed
+	ClosesAt      *time.Time        `bson:"-" json:"closes_at,omitempty"` // When open and not 24 hours
+	SearchTerms   string            `bson:"searchterms" json:"-"`
+	SubmittedBy   bson.ObjectId     `bson:"submittedby,omitempty" json:"submitted_by,omitempty"` // User who submitted it
+	ExternalId    string            `bson:"externalid,omitempty" json:"-"`                       // Id in the imported registry
+	Imported      time.Time         `bson:",omitempty" json:"-"`
+	MergedInto    bson.ObjectId     `bson:"mergedinto,omitempty" json:"mergedinto,omitempty"` // Duplicate merged into this hospital
+	Merged        time.Time         `bson:",omitempty" json:"-"`
 	Updated       time.Time         `json:"updated"`
 	Created       time.Time         `json:"created"`
 }
@@ -71,6 +160,9 @@ func (i *Hospital) Insert() (err error) {
 	i.Id = bson.NewObjectId()
 	i.Updated = time.Now()
 	i.Created = time.Now()
+	i.setRegion()
+	i.SearchTerms = i.searchTerms()
+	i.Rating = NewHospitalRating()
 
 	if err = dbcHospitals.Insert(&i); err != nil {
 		log.Println("Could not insert a hospital.")
@@ -86,10 +178,30 @@ func (i *Hospital) Update() (err error) {
 		return
 	}
 
+	i.setRegion()
+	i.SearchTerms = i.searchTerms()
 	err = dbcHospitals.UpdateId(i.Id, &i)
 	return
 }
 
+// Fields of hospitals set by applyEdit.
+var hospitalEditFields = []string{
+	"name", "location", "region", "address", "phonenumber", "contactinfo", "extrainfo", "hours",
+	"holidays", "is24hours", "hasemergency", "species", "searchterms", "updated",
+}
+
+// saveEdit saves the fields set by applyEdit and fields, leaving likes,
+// follows and others as they are in DB.
+func (i *Hospital) saveEdit(fields ...string) error {
+	if i.Id.Valid() == false {
+		return errors.New("Invalid Hospital Id")
+	}
+
+	i.setRegion()
+	i.SearchTerms = i.searchTerms()
+	return setFields(dbcHospitals, i.Id, i, append(hospitalEditFields, fields...)...)
+}
+
 func (i *Hospital) Delete() (err error) {
 	if i.Id.Valid() == false {
 		err = errors.New("Invalid Hospital Id")
@@ -106,37 +218,77 @@ func (i *Hospital) GetById(id bson.ObjectId) (err error) {
 		return
 	}
 
+	// Merged hospitals redirect to the hospital they were merged into.
+	if i.MergedInto.Valid() {
+		return i.GetById(resolveHospitalId(i.MergedInto))
+	}
+
 	return
 }
 
-func (i *Hospital) Like(userId bson.ObjectId) (alreadyLiked bool, err error) {
-	if err := i.GetById(i.Id); err != nil {
-		return false, err
+func (i *Hospital) SortValue(key SortKey) interface{} {
+	switch key.Field {
+	case "rating.average":
+		return i.Rating.Average
+	case "rating.count":
+		return i.Rating.Count
 	}
+	return i.Created
+}
 
-	n, err := dbcHospitals.Find(bson.M{"_id": i.Id, "likes": bson.M{"$in": []bson.ObjectId{userId}}}).Count()
-	if err != nil {
-		return false, err
+// Validate checks the location, hours and services of the hospital.
+func (i *Hospital) Validate() error {
+	if err := validateLocation(i.Location); err != nil {
+		return err
 	}
-
-	if n > 0 {
-		return true, nil
+	for n := range i.Hours {
+		if err := i.Hours[n].Validate(); err != nil {
+			return err
+		}
+	}
+	for n := range i.Holidays {
+		if err := i.Holidays[n].Validate(); err != nil {
+			return err
+		}
 	}
+	return validateServices(i.Services)
+}
 
-	i.Likes = append(i.Likes, userId)
-	err = i.Update()
+func (i *Hospital) searchTerms() string {
+	return searchTerms(i.Name, i.Address)
+}
 
+func (i *Hospital) Like(userId bson.ObjectId) (alreadyLiked bool, err error) {
+	alreadyLiked, i.LikeCount, err = addLike(dbcHospitals, i.Id, userId)
 	if err != nil {
 		log.Println("Erro while liking hospital.")
 		return false, err
 	}
-	return false, err
+
+	i.Liked = true
+	return alreadyLiked, nil
+}
+
+func (i *Hospital) Unlike(userId bson.ObjectId) (notLiked bool, err error) {
+	notLiked, i.LikeCount, err = removeLike(dbcHospitals, i.Id, userId)
+	if err != nil {
+		log.Println("Erro while unliking hospital.")
+		return false, err
+	}
+
+	i.Liked = false
+	return notLiked, nil
+}
+
+// SetLiked sets Liked for the user who requested the hospital.
+func (i *Hospital) SetLiked(userId bson.ObjectId) {
+	i.Liked = isLikedBy(i.Likes, userId)
 }
 
 /////////////////////////    CONTROLLERS   ///////////////////////////
 
 func getHospital(gc *gin.Context) {
-	loggedIn, _ := isLoggedIn(gc)
+	loggedIn, myAccount := isLoggedIn(gc)
 	if loggedIn == false {
 		return
 	}
@@ -158,46 +310,42 @@ func getHospital(gc *gin.Context) {
 		return
 	}
 
-	gc.JSON(http.StatusOK, gin.H{
+	hospital.SetLiked(myAccount.Id)
+	hospital.Followed = isFollowing(myAccount.Id, "hospital", hospital.Id)
+	hospital.SetOpenStatus(time.Now())
+
+	response := gin.H{
 		"status":   0,
 		"message":  "Successfully fetched Hospital.",
 		"hospital": hospital,
-	})
+	}
+	if hospital.Id != id {
+		response["mergedfrom"] = id
+	}
+	gc.JSON(http.StatusOK, response)
 	return
 }
 
+// getHospitals lists hospitals filtered as in HospitalQuery.Parse.
 func getHospitals(gc *gin.Context) {
-	loggedIn, _ := isLoggedIn(gc)
+	loggedIn, myAccount := isLoggedIn(gc)
 	if loggedIn == false {
 		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Not Logged In."})
 		return
 	}
 
-	skip := 0
-	limit := 50
-
-	// TODO Get Hospitals by Filter
-
-	var hospitals []Hospital
-	if err := dbcHospitals.Find(nil).Sort("created").Skip(skip).Limit(limit).All(&hospitals); err != nil {
-		log.Print(err)
-		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error while retrieving data from DB."})
-		return
-	}
-
-	if len(hospitals) == 0 {
-		log.Print("No Hospitals")
-		gc.JSON(http.StatusOK, gin.H{"status": -2, "message": "No hospitals."})
+	hq := NewHospitalQuery()
+	if err := hq.Parse(gc); err != nil {
 		return
 	}
 
-	log.Println("Fetched " + strconv.Itoa(len(hospitals)) + " rows.")
-	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Successfully fetched My Hospitals.", "data": hospitals})
-	return
+	listHospitals(gc, hq, DefaultPageLimit, myAccount.Id)
 }
 
+// getHospitalsNearby lists hospitals within posted distance, nearest first.
+// Query string filters as in getHospitals.
 func getHospitalsNearby(gc *gin.Context) {
-	loggedIn, _ := isLoggedIn(gc)
+	loggedIn, myAccount := isLoggedIn(gc)
 	if loggedIn == false {
 		return
 	}
@@ -214,52 +362,28 @@ func getHospitalsNearby(gc *gin.Context) {
 		return
 	}
 
-	var results []Hospital
-
-	if err := dbcHospitals.Find(bson.M{
-		"location": bson.M{
-			"$nearSphere": bson.M{
-				"$geometry": bson.M{
-					"type":        "Point",
-					"coordinates": []float64{posted.Longitude, posted.Latitude},
-				},
-			},
-		},
-	}).Limit(10).All(&results); err != nil {
-		log.Print(err)
-		gc.JSON(http.StatusOK, gin.H{
-			"status":  -1,
-			"message": "Could not find.",
-		})
+	hq := NewHospitalQuery()
+	hq.SetNear(posted)
+	if err := hq.Parse(gc); err != nil {
 		return
 	}
 
-	if len(results) == 0 {
-		log.Print("No hospital found nearby.")
-		gc.JSON(http.StatusOK, gin.H{
-			"status":  -1,
-			"message": "No Hospitals found nearby.",
-		})
+	listHospitals(gc, hq, DefaultPageLimit, myAccount.Id)
+}
+
+// insertHospital writes a hospital directly. Users submit hospitals with
+// submitHospital instead.
+func insertHospital(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
 		return
 	}
 
-	if str, err := json.MarshalIndent(results, "", "  "); err == nil {
-		log.Printf("%s", str)
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
+		return
 	}
 
-	gc.JSON(http.StatusOK, gin.H{
-		"status":    0,
-		"message":   "Fetched Hospitals nearby.",
-		"hospitals": results,
-	})
-}
-
-func insertHospital(gc *gin.Context) {
-	//loggedIn, _ := isLoggedIn(gc)
-	//if loggedIn == false {
-	//return
-	//}
-
 	DumpRequestBody(gc)
 
 	var posted Hospital
@@ -271,6 +395,11 @@ func insertHospital(gc *gin.Context) {
 
 	posted.Location.Type = "Point"
 
+	if err := posted.Validate(); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
 	if err := posted.Insert(); err != nil {
 		log.Println(err)
 		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Failed to insert hospital to DB."})
@@ -281,25 +410,42 @@ func insertHospital(gc *gin.Context) {
 	}
 }
 
+// updateHospital edits posted fields of a hospital directly. Users suggest
+// edits with submitHospital instead.
 func updateHospital(gc *gin.Context) {
-	loggedIn, _ := isLoggedIn(gc)
+	loggedIn, myAccount := isLoggedIn(gc)
 	if loggedIn == false {
 		return
 	}
 
-	var posted Hospital
-	if err := gc.BindJSON(&posted); err != nil {
-		log.Println(err)
-		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Parsing posted JSON failed."})
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
 		return
 	}
 
-	if err := posted.Update(); err != nil {
+	posted, fields, ok := bindHospitalEdit(gc)
+	if ok == false {
+		return
+	}
+
+	if err := posted.Validate(); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	var hospital Hospital
+	if err := hospital.GetById(posted.Id); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	hospital.applyEdit(&posted, fields)
+	if err := hospital.saveEdit(); err != nil {
 		log.Println(err)
 		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Failed to insert hospital to DB."})
 		return
 	} else {
-		gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Uploaded hospital!", "newid": posted.Id.Hex()})
+		gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Uploaded hospital!", "newid": hospital.Id.Hex()})
 		return
 	}
 
@@ -334,11 +480,40 @@ func likeHospital(gc *gin.Context) {
 
 	} else {
 		if alreadyLiked == true {
-			gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Your already liked it!"})
+			gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Your already liked it!", "like_count": hospital.LikeCount})
 			return
 		}
 	}
 
-	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "You Liked the hospital!"})
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "You Liked the hospital!", "like_count": hospital.LikeCount})
 	return
 }
+
+func unlikeHospital(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	hospital := Hospital{Id: resolveHospitalId(id)}
+	if notLiked, err := hospital.Unlike(myAccount.Id); err == mgo.ErrNotFound {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "No Hospital found matching ObjectId."})
+		return
+
+	} else if err != nil {
+		log.Println(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error while updating DB!"})
+		return
+
+	} else if notLiked == true {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "You have not liked it.", "like_count": hospital.LikeCount})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "You Unliked the hospital.", "like_count": hospital.LikeCount})
+}
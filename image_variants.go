@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/draw"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var makeImageVariants = flag.Bool("imagevariants", false, "Makes missing resized variants of uploaded images and exits")
+
+const imageDir = rootDir + "/img/"
+
+// imageSize is a variant of uploaded images fit in Max pixels on the longer
+// side. Variants are in imageDir + Name, as thumbnails in "thumb".
+type imageSize struct {
+	Name string
+	Max  int
+}
+
+var imageSizes = []imageSize{
+	{"thumb", 200},
+	{"medium", 640},
+	{"large", 1280},
+}
+
+const (
+	imageJpegQuality = 85
+	imageWebPQuality = 80
+)
+
+// Images of more pixels are not decoded, as they take memory of 4 bytes a
+// pixel however small the file is.
+const maxImagePixels = 50 * 1000 * 1000
+
+var ErrImageTooLarge = errors.New("Image is too large.")
+
+func lookupImageSize(name string) (imageSize, bool) {
+	for _, size := range imageSizes {
+		if size.Name == name {
+			return size, true
+		}
+	}
+	return imageSize{}, false
+}
+
+// variantPath returns the path of the variant of the image in size. WebP
+// variants are next to the others.
+func (i *Image) variantPath(size string, webP bool) string {
+	name := i.Filename
+	if webP {
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + ".webp"
+	}
+	return imageDir + size + "/" + name
+}
+
+// exifOrientation reads the orientation from EXIF of JPEG data. 1 is
+// upright and the others are as defined in EXIF.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for pos := 2; pos+2 <= len(data) && data[pos] == 0xFF; {
+		marker := data[pos+1]
+		if marker == 0xFF { // Fill byte
+			pos++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) { // TEM and RST have no length
+			pos += 2
+			continue
+		}
+		if marker == 0xDA || pos+4 > len(data) { // Image data starts
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation reads tag 0x0112 of IFD0 in the TIFF header of EXIF.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// orient turns img upright from EXIF orientation.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := w, h
+	if orientation >= 5 { // Rotated by 90 degrees
+		dstW, dstH = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored
+				dx, dy = w-1-x, y
+			case 3: // Upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // Upside down and mirrored
+				dx, dy = x, h-1-y
+			case 5: // Transposed
+				dx, dy = y, x
+			case 6: // Turned counterclockwise
+				dx, dy = h-1-y, x
+			case 7: // Transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // Turned clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// fit resizes img to fit in max pixels on the longer side once turned by
+// orientation. Smaller images are not enlarged.
+func fit(img image.Image, max int, orientation int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	longer := w
+	if h > longer {
+		longer = h
+	}
+
+	// Resized before turned, which is the same and faster.
+	if longer > max {
+		w, h = w*max/longer, h*max/longer
+		if w < 1 {
+			w = 1
+		}
+		if h < 1 {
+			h = 1
+		}
+
+		resized := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Over, nil)
+		img = resized
+	}
+
+	return orient(img, orientation)
+}
+
+func writeImageFile(path string, img image.Image, format string) (err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	switch format {
+	case "png":
+		err = png.Encode(file, img)
+	case "webp":
+		err = webp.Encode(file, img, &webp.Options{Quality: imageWebPQuality})
+	default:
+		err = jpeg.Encode(file, img, &jpeg.Options{Quality: imageJpegQuality})
+	}
+	return
+}
+
+// MakeVariants writes variants of the image in every size, as the original
+// format and as WebP, and sets ThumbnailPath and Variants. Images of more
+// than maxImagePixels are ErrImageTooLarge.
+func (i *Image) MakeVariants() error {
+	data, err := os.ReadFile(imageDir + i.Filename)
+	if err != nil {
+		return err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return ErrImageTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = exifOrientation(data)
+	}
+
+	variants := make([]string, 0, len(imageSizes))
+	for _, size := range imageSizes {
+		resized := fit(img, size.Max, orientation)
+
+		if err := writeImageFile(i.variantPath(size.Name, false), resized, format); err != nil {
+			return err
+		}
+		if err := writeImageFile(i.variantPath(size.Name, true), resized, "webp"); err != nil {
+			return err
+		}
+		variants = append(variants, size.Name)
+	}
+
+	i.Variants = variants
+	i.ThumbnailPath = strings.TrimPrefix(i.variantPath("thumb", false), imageDir)
+	return nil
+}
+
+// removeVariants deletes files of variants of the image.
+func (i *Image) removeVariants() {
+	for _, size := range i.Variants {
+		for _, webP := range []bool{false, true} {
+			if err := os.Remove(i.variantPath(size, webP)); err != nil && os.IsNotExist(err) == false {
+				log.Println("Failed to delete an image variant. err:" + err.Error())
+			}
+		}
+	}
+}
+
+// backfillImageVariants makes variants of images uploaded before they were
+// made on upload.
+func backfillImageVariants() {
+	var image Image
+	iter := dbcImages.Find(bson.M{"variants": bson.M{"$exists": false}}).Iter()
+
+	made, failed := 0, 0
+	for iter.Next(&image) {
+		if err := image.MakeVariants(); err != nil {
+			log.Printf("Image %s: %s", image.Id.Hex(), err.Error())
+			failed++
+			continue
+		}
+
+		if err := dbcImages.UpdateId(image.Id, bson.M{"$set": bson.M{
+			"variants":      image.Variants,
+			"thumbnailpath": image.ThumbnailPath,
+		}}); err != nil {
+			log.Print(err)
+			failed++
+			continue
+		}
+		made++
+	}
+	if err := iter.Close(); err != nil {
+		log.Print(err)
+	}
+
+	log.Printf("Made variants of %d images. %d failed.", made, failed)
+}
@@ -44,6 +44,7 @@ type Image struct {
 	RelatedId     bson.ObjectId `bson:",omitempty" json:"relatedid" form:"relatedid"`
 	Filename      string        `json:"filename"`
 	ThumbnailPath string        `json:"thumb_path"`
+	Variants      []string      `bson:",omitempty" json:"variants,omitempty"` // Sizes made. See imageSizes.
 	Taken         time.Time     `json:"-"`
 	Created       time.Time     `json:"created"`
 }
@@ -79,6 +80,7 @@ func (i *Image) Delete() (err error) {
 	if err = os.Remove("./web/img/" + i.Filename); err != nil {
 		log.Println("Failed to delete an image file. err:" + err.Error())
 	}
+	i.removeVariants()
 	return
 }
 
@@ -113,13 +115,20 @@ func getImage(gc *gin.Context) {
 		return
 	}
 
+	// thumbnail is the name of thumb before variants were made.
 	sizeStr := gc.DefaultQuery("size", "original")
+	if sizeStr == "thumbnail" {
+		sizeStr = "thumb"
+	}
+
 	fileDir := "./web/img/"
-	var filepath string
-	if sizeStr == "original" {
-		filepath = fileDir + image.Filename
-	} else if sizeStr == "thumbnail" {
-		filepath = fileDir + "/thumb/" + image.Filename
+	filepath := fileDir + image.Filename
+
+	// Variants in WebP to clients accepting it. Original until made.
+	if _, ok := lookupImageSize(sizeStr); ok && len(image.Variants) > 0 {
+		webP := strings.Contains(gc.Request.Header.Get("Accept"), "image/webp")
+		filepath = image.variantPath(sizeStr, webP)
+		gc.Header("Vary", "Accept")
 	}
 
 	gc.File(filepath)
@@ -175,6 +184,15 @@ func insertImage(gc *gin.Context) {
 	io.Copy(destFile, tempFile)
 
 	posted.Filename = fileName
+	if err := posted.MakeVariants(); err == ErrImageTooLarge {
+		destFile.Close()
+		os.Remove("./web/img/" + fileName)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	} else if err != nil {
+		log.Println("Could not make image variants. err: " + err.Error())
+	}
+
 	if _, err := posted.Insert(); err != nil {
 		log.Println("Error inserting image to db. err: " + err.Error())
 		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error insert image to db!"})
@@ -189,13 +207,7 @@ func insertImage(gc *gin.Context) {
 			return
 		}
 
-		if review.Images == nil {
-			review.Images = make([]bson.ObjectId, 0)
-		}
-		review.Images = append(review.Images, posted.Id)
-		review.IsDraft = false
-
-		if _, err := review.Update(); err != nil {
+		if err := dbcReviews.UpdateId(review.Id, bson.M{"$push": bson.M{"images": posted.Id}}); err != nil {
 			log.Println(err)
 			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error while updating review! B"})
 			return
@@ -228,10 +240,11 @@ func insertImage(gc *gin.Context) {
 	}
 
 	gc.JSON(http.StatusOK, gin.H{
-		"status":   0,
-		"message":  "Successfully uploded a file!",
-		"newid":    posted.Id.Hex(),
-		"filename": fileName,
+		"status":     0,
+		"message":    "Successfully uploded a file!",
+		"newid":      posted.Id.Hex(),
+		"filename":   fileName,
+		"thumb_path": posted.ThumbnailPath,
 	})
 	return
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Reviews, hospitals and comments keep ids of users who liked them in "likes"
+// and its size in "likecount". Both are changed in one atomic update, so
+// concurrent likes do not overwrite each other.
+
+type likeCount struct {
+	LikeCount int `bson:"likecount"`
+}
+
+// addLike adds userId to likes of the document. alreadyLiked is true when
+// userId was in likes already. Returns mgo.ErrNotFound if there is no document.
+func addLike(col *mgo.Collection, id bson.ObjectId, userId bson.ObjectId) (alreadyLiked bool, count int, err error) {
+	var doc likeCount
+	_, err = col.Find(bson.M{"_id": id, "likes": bson.M{"$ne": userId}}).Apply(mgo.Change{
+		Update: bson.M{
+			"$addToSet": bson.M{"likes": userId},
+			"$inc":      bson.M{"likecount": 1},
+		},
+		ReturnNew: true,
+	}, &doc)
+
+	if err == mgo.ErrNotFound {
+		err = col.FindId(id).Select(bson.M{"likecount": 1}).One(&doc)
+		return true, doc.LikeCount, err
+	}
+
+	return false, doc.LikeCount, err
+}
+
+// removeLike removes userId from likes of the document. notLiked is true
+// when userId was not in likes. Returns mgo.ErrNotFound if there is no document.
+func removeLike(col *mgo.Collection, id bson.ObjectId, userId bson.ObjectId) (notLiked bool, count int, err error) {
+	var doc likeCount
+	_, err = col.Find(bson.M{"_id": id, "likes": userId}).Apply(mgo.Change{
+		Update: bson.M{
+			"$pull": bson.M{"likes": userId},
+			"$inc":  bson.M{"likecount": -1},
+		},
+		ReturnNew: true,
+	}, &doc)
+
+	if err == mgo.ErrNotFound {
+		err = col.FindId(id).Select(bson.M{"likecount": 1}).One(&doc)
+		return true, doc.LikeCount, err
+	}
+
+	return false, doc.LikeCount, err
+}
+
+func isLikedBy(likes []bson.ObjectId, userId bson.ObjectId) bool {
+	for _, id := range likes {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// backfillLikeCount sets likecount on documents saved before it existed.
+func backfillLikeCount(col *mgo.Collection) {
+	var doc struct {
+		Id    bson.ObjectId   `bson:"_id"`
+		Likes []bson.ObjectId `bson:"likes"`
+	}
+
+	iter := col.Find(bson.M{"likecount": bson.M{"$exists": false}}).Iter()
+	for iter.Next(&doc) {
+		if err := col.UpdateId(doc.Id, bson.M{"$set": bson.M{"likecount": len(doc.Likes)}}); err != nil {
+			log.Print(err)
+		}
+	}
+
+	if err := iter.Close(); err != nil {
+		log.Print(err)
+	}
+}
@@ -27,6 +27,9 @@ func (hs HostSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 const rootDir = "./web"
 
+// Defined before flags are parsed in isDevMode.
+var draftExpiryDays = flag.Int("draftdays", 30, "Drafts not saved for the days are removed")
+
 var devMode = isDevMode()
 var requestLogginEnabled = isRequestLoggingEnabled()
 var dbName = setDbName()
@@ -57,6 +60,24 @@ func main() {
 	// DB and Collections are Automatically Opened. Checkout database.go
 	defer CloseDb() // Needs this line only!
 
+	if err := loadRegions(*regionsFile); err != nil {
+		log.Printf("Reverse geocoding is off. %s", err.Error())
+	}
+
+	if *importHospitalsFile != "" {
+		runHospitalImport()
+		return
+	}
+
+	if *makeImageVariants {
+		backfillImageVariants()
+		return
+	}
+
+	if len(boundaries) > 0 {
+		go backfillRegions()
+	}
+
 	if devMode == false {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -70,7 +91,11 @@ func main() {
 	})
 	router.Use(sessions.Sessions("dotor_session", store))
 
-	//newReditClient()
+	newReditClient()
+
+	go runDraftCleanup()
+
+	router.LoadHTMLFiles(rootDir + "/" + shareTemplate)
 
 	router.Static("/img", (rootDir + "/img"))
 	router.Static("/thumb", (rootDir + "/img/thumb"))
@@ -98,23 +123,76 @@ func main() {
 
 	router.GET("/review/:id", getReview)
 	router.POST("/review/insert", insertReview)
-	router.POST("/review/update", updateReview)
+	router.POST("/review/update/:id", updateReview)
 	router.POST("/review/delete/:id", deleteReview)
 
+	router.POST("/review/approve/:id", approveReview) // Admin
+	router.POST("/review/reject/:id", rejectReview)   // Admin
+
+	router.POST("/review/respond/:id", respondReview)                // Hospital staff
+	router.POST("/review/response/delete/:id", deleteReviewResponse) // Hospital staff
+
+	router.POST("/review/share/:id", shareReview)
+	router.POST("/review/unshare/:id", unshareReview)
+	router.GET("/share/:slug", getSharedReview)
+
 	router.POST("/review/like/:id", likeReview)
+	router.POST("/review/unlike/:id", unlikeReview)
 
+	router.GET("/review/:id/revisions", getReviewRevisions)
+
+	router.POST("/review/draft", saveDraft)
+	router.POST("/review/publish/:id", publishDraft)
+
+	router.GET("/reviews", getReviews)
+	router.GET("/reviews/feed", getFeed)
+	router.GET("/reviews/trending", getTrending)
 	router.GET("/reviews/all", getReviews)
 	router.GET("/reviews/my", getMyReviews)
+	router.GET("/reviews/drafts", getMyDrafts)
+	router.GET("/reviews/pending", getPendingReviews) // Admin
 	router.POST("/reviews/location", getReviewsByLocation)
+	router.GET("/reviews/clusters", getReviewClusters)
 	router.POST("/reviews/pet", getReviewsByPet)
 	router.POST("/reviews/category/:categories", getReviewsByCategory)
 
+	router.GET("/stats/cost", getCostStats)
+
+	router.GET("/search/reviews", searchReviews)
+	router.GET("/search/hospitals", searchHospitals)
+	router.GET("/search/comments", searchComments)
+
 	router.POST("/image/insert", insertImage)
 	router.GET("/image/:id", getImage)
 
 	router.GET("/hospital/get/:id", getHospital)
-	router.POST("/hospital/insert", insertHospital)
+	router.GET("/hospital/detail/:id", getHospitalDetail)
+	router.GET("/hospital/reviews/:id", getHospitalReviews)
+	router.POST("/hospital/insert", insertHospital)               // Admin
+	router.POST("/hospital/merge/:id", mergeHospital)             // Admin
+	router.GET("/hospital/duplicates/:id", getHospitalDuplicates) // Admin
+	router.GET("/hospitals/duplicates", getAllHospitalDuplicates) // Admin
+	router.POST("/hospital/submit", submitHospital)
+	router.POST("/hospital/suggest/:id", submitHospital)
+	router.POST("/hospital/submission/approve/:id", approveHospitalSubmission) // Admin
+	router.POST("/hospital/submission/reject/:id", rejectHospitalSubmission)   // Admin
+	router.GET("/hospitals/submissions", getHospitalSubmissions)               // Admin
+	router.GET("/hospitals/submissions/my", getMyHospitalSubmissions)
+	router.POST("/hospital/claim/:id", claimHospital)
+	router.POST("/hospital/staff/approve/:id", approveHospitalClaim) // Admin
+	router.POST("/hospital/staff/reject/:id", rejectHospitalClaim)   // Admin
+	router.GET("/hospitals/claims", getHospitalClaims)               // Admin
+	router.GET("/hospitals/claims/my", getMyHospitalClaims)
+	router.POST("/hospital/staff/update/:id", updateStaffHospital) // Hospital staff
+	router.GET("/hospital/services/:id", getHospitalServices)
+	router.POST("/hospital/services/:id", updateHospitalServices) // Admin or hospital staff
+	router.GET("/services", getServiceCatalog)
+	router.GET("/services/search", searchServices)
+	router.GET("/hospitals", getHospitals)
+	router.GET("/hospitals/clusters", getHospitalClusters)
 	router.POST("/hospitals/nearby", getHospitalsNearby)
+	router.POST("/hospital/like/:id", likeHospital)
+	router.POST("/hospital/unlike/:id", unlikeHospital)
 
 	router.GET("/notification/:id", getNotification)
 
@@ -129,7 +207,22 @@ func main() {
 	router.POST("/comment/delete/:id", deleteComment)
 
 	router.GET("/comments/:category/:relatedid", getComments)
-	//router.POST("/comment/like/:id", likeComment)
+	router.POST("/comment/like/:id", likeComment)
+	router.POST("/comment/unlike/:id", unlikeComment)
+
+	router.GET("/reviews/following", getFollowingReviews)
+	router.GET("/followers/:category/:id", getFollowers)
+	router.GET("/following/:id", getFollowing)
+	router.POST("/follow/insert/:category/:id", insertFollow)
+	router.POST("/follow/delete/:category/:id", deleteFollow)
+
+	router.GET("/bookmarks", getMyBookmarks)
+	router.GET("/bookmarks/collections", getMyBookmarkCollections)
+	router.POST("/bookmark/insert/:category/:id", insertBookmark)
+	router.POST("/bookmark/delete/:category/:id", deleteBookmark)
+	router.POST("/bookmark/collection/insert", insertBookmarkCollection)
+	router.POST("/bookmark/collection/update/:id", updateBookmarkCollection)
+	router.POST("/bookmark/collection/delete/:id", deleteBookmarkCollection)
 
 	router.POST("/settings/push/upsert", upsertPushSetting)
 
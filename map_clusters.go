@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Markers closer than a cell of the grid are clustered. A 256 pixel tile is
+// split into the cells per side, so a cell is 64 pixels wide on screen.
+const clusterCellsPerTile = 4
+
+const maxZoom = 22
+
+// Cells of the grid in a box at most. Cells are grown for zoom too low for
+// the box, so clusters stay bounded whatever is asked.
+const maxClusterCells = 1024
+
+// BoundingBox is the viewport of a map in degrees.
+type BoundingBox struct {
+	West, South, East, North float64
+}
+
+// parseBoundingBox reads "west,south,east,north" as in "bbox" of query string.
+func parseBoundingBox(str string) (box BoundingBox, err error) {
+	values := strings.Split(str, ",")
+	if len(values) != 4 {
+		return box, errors.New("Invalid bbox.")
+	}
+
+	var coords [4]float64
+	for n, value := range values {
+		if coords[n], err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			return box, errors.New("Invalid bbox.")
+		}
+	}
+
+	box = BoundingBox{West: coords[0], South: coords[1], East: coords[2], North: coords[3]}
+	if box.West < -180 || box.East > 180 || box.West >= box.East ||
+		box.South < -90 || box.North > 90 || box.South >= box.North {
+		return box, errors.New("Invalid bbox.")
+	}
+	return box, nil
+}
+
+// Query matches locations in the box.
+func (b BoundingBox) Query() bson.M {
+	return bson.M{
+		"$geoWithin": bson.M{
+			"$geometry": bson.M{
+				"type": "Polygon",
+				"coordinates": [][][]float64{{
+					{b.West, b.South}, {b.East, b.South}, {b.East, b.North}, {b.West, b.North}, {b.West, b.South},
+				}},
+			},
+		},
+	}
+}
+
+// MapCluster is a marker standing for Count documents around its location.
+// Id is of the document when it stands for one. Open status is of the
+// hospital it stands for.
+type MapCluster struct {
+	Latitude  float64       `json:"latitude"`
+	Longitude float64       `json:"longitude"`
+	Count     int           `json:"count"`
+	Id        bson.ObjectId `json:"id,omitempty"`
+	Distance  float64       `json:"distance,omitempty"` // From the queried point
+	IsOpen    *bool         `json:"is_open,omitempty"`
+	OpensAt   *time.Time    `json:"opens_at,omitempty"`
+	ClosesAt  *time.Time    `json:"closes_at,omitempty"`
+}
+
+// setClustersOpenStatus sets open status of clusters standing for a hospital.
+func setClustersOpenStatus(clusters []MapCluster) {
+	var ids []bson.ObjectId
+	for _, cluster := range clusters {
+		if cluster.Id.Valid() {
+			ids = append(ids, cluster.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	var hospitals []Hospital
+	if err := dbcHospitals.Find(bson.M{"_id": bson.M{"$in": ids}}).
+		Select(bson.M{"hours": 1, "holidays": 1, "is24hours": 1}).All(&hospitals); err != nil {
+		log.Print(err)
+		return
+	}
+	setHospitalsOpenStatus(hospitals, time.Now())
+
+	byId := make(map[bson.ObjectId]*Hospital, len(hospitals))
+	for n := range hospitals {
+		byId[hospitals[n].Id] = &hospitals[n]
+	}
+	for n := range clusters {
+		if hospital, ok := byId[clusters[n].Id]; ok {
+			isOpen := hospital.IsOpen
+			clusters[n].IsOpen, clusters[n].OpensAt, clusters[n].ClosesAt = &isOpen, hospital.OpensAt, hospital.ClosesAt
+		}
+	}
+}
+
+// clusterCellSize returns the width in degrees of longitude of a cell at zoom.
+func clusterCellSize(zoom int) float64 {
+	return 360 / math.Exp2(float64(zoom)) / clusterCellsPerTile
+}
+
+// mapClusters groups documents of col matching query, in box, into cells of
+// the grid at zoom.
+func mapClusters(col *mgo.Collection, query bson.M, box BoundingBox, zoom int) ([]MapCluster, error) {
+	// Cells are about square on screen in the middle of the box.
+	lonCell := clusterCellSize(zoom)
+	latCell := lonCell * math.Cos((box.South+box.North)/2*math.Pi/180)
+	for (math.Ceil((box.East-box.West)/lonCell)+1)*(math.Ceil((box.North-box.South)/latCell)+1) > maxClusterCells {
+		lonCell *= 2
+		latCell *= 2
+	}
+
+	lon := bson.M{"$arrayElemAt": []interface{}{"$location.coordinates", 0}}
+	lat := bson.M{"$arrayElemAt": []interface{}{"$location.coordinates", 1}}
+
+	var groups []struct {
+		Count     int           `bson:"count"`
+		Longitude float64       `bson:"longitude"`
+		Latitude  float64       `bson:"latitude"`
+		Id        bson.ObjectId `bson:"id"`
+	}
+	if err := col.Pipe([]bson.M{
+		{"$match": query},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"x": bson.M{"$floor": bson.M{"$divide": []interface{}{lon, lonCell}}},
+				"y": bson.M{"$floor": bson.M{"$divide": []interface{}{lat, latCell}}},
+			},
+			"count":     bson.M{"$sum": 1},
+			"longitude": bson.M{"$avg": lon},
+			"latitude":  bson.M{"$avg": lat},
+			"id":        bson.M{"$first": "$_id"},
+		}},
+		{"$limit": maxClusterCells},
+	}).All(&groups); err != nil {
+		return nil, err
+	}
+
+	clusters := make([]MapCluster, 0, len(groups))
+	for _, group := range groups {
+		cluster := MapCluster{Latitude: group.Latitude, Longitude: group.Longitude, Count: group.Count}
+		if group.Count == 1 {
+			cluster.Id = group.Id
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+// respondClusters responds with clusters of documents of col matching
+// query, set further by set when given. "bbox" and "zoom" are required.
+func respondClusters(gc *gin.Context, col *mgo.Collection, query bson.M, box *BoundingBox, near *NearRequest, set func([]MapCluster)) {
+	if box == nil {
+		MissingRequiredValue(gc, "bbox")
+		return
+	}
+
+	zoom, err := strconv.Atoi(gc.Query("zoom"))
+	if err != nil || zoom < 0 || zoom > maxZoom {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid zoom."})
+		return
+	}
+
+	clusters, err := mapClusters(col, query, *box, zoom)
+	if err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	if set != nil {
+		set(clusters)
+	}
+
+	if near != nil {
+		for n := range clusters {
+			clusters[n].Distance = distanceMeters(near.Latitude, near.Longitude, clusters[n].Latitude, clusters[n].Longitude)
+		}
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(clusters)) + " clusters.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":   0,
+		"message":  "Successfully fetched clusters.",
+		"clusters": clusters,
+	})
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+// getReviewClusters responds with markers of reviews in "bbox" clustered by
+// "zoom". Filters are the same as of review lists. See ReviewQuery.Parse.
+func getReviewClusters(gc *gin.Context) {
+	loggedIn, _ := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	rq := NewReviewQuery()
+	if err := rq.Parse(gc); err != nil {
+		return
+	}
+
+	respondClusters(gc, dbcReviews, rq.Query(), rq.Box, rq.Near, nil)
+}
+
+// getHospitalClusters responds with markers of hospitals in "bbox" clustered
+// by "zoom". Filters are the same as of hospital lists. See HospitalQuery.Parse.
+func getHospitalClusters(gc *gin.Context) {
+	loggedIn, _ := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	hq := NewHospitalQuery()
+	if err := hq.Parse(gc); err != nil {
+		return
+	}
+
+	respondClusters(gc, dbcHospitals, hq.Query(), hq.Box, hq.Near, setClustersOpenStatus)
+}
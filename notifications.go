@@ -94,6 +94,7 @@ func (i *Notification) Insert() (newId bson.ObjectId, err error) {
 		IsPushOn:    false,
 		GetLikes:    false,
 		GetComments: false,
+		GetFollows:  false,
 	}
 
 	if err := pushSetting.GetById(i.UserId); err != nil {
@@ -113,13 +114,19 @@ func (i *Notification) Insert() (newId bson.ObjectId, err error) {
 	}
 
 	if pushSetting.GetLikes == false {
-		if i.Type == "review_likes" {
+		if i.Type == "review_like" || i.Type == "comment_like" {
 			return i.Id, nil
 		}
 	}
 
 	if pushSetting.GetComments == false {
-		if i.Type == "review_comments" {
+		if i.Type == "review_comment" {
+			return i.Id, nil
+		}
+	}
+
+	if pushSetting.GetFollows == false {
+		if i.Type == NotificationFollowReview || i.Type == NotificationHospitalReview {
 			return i.Id, nil
 		}
 	}
@@ -257,19 +264,36 @@ func getMyNotifications(gc *gin.Context) {
 		return
 	}
 
-	skip := 0
-	limit := 20
+	page, err := getPageFromQuery(gc, DefaultPageLimit, SortKeyCreated, true)
+	if err != nil {
+		return
+	}
 
 	var notifications []Notification
-	err := dbcNotifications.Find(bson.M{"userid": myAccount.Id}).Sort("-created").Skip(skip).Limit(limit).All(&notifications)
+	query := page.Query(bson.M{"userid": myAccount.Id})
+	err = dbcNotifications.Find(query).Sort(page.Sort()...).Limit(page.QueryLimit()).All(&notifications)
 	if err != nil {
 		log.Print(err)
 		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error while retrieving data from DB."})
 		return
 	}
 
+	hasMore := page.HasMore(len(notifications))
+	nextCursor := ""
+	if hasMore {
+		notifications = notifications[:page.Limit]
+		last := notifications[len(notifications)-1]
+		nextCursor = NewCursor(last.Created, last.Id).Encode()
+	}
+
 	log.Println("Fetched " + strconv.Itoa(len(notifications)) + " rows.")
-	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Successfully fetched My Notifications.", "notifications": notifications})
+	gc.JSON(http.StatusOK, gin.H{
+		"status":        0,
+		"message":       "Successfully fetched My Notifications.",
+		"notifications": notifications,
+		"next_cursor":   nextCursor,
+		"has_more":      hasMore,
+	})
 }
 
 func deleteNotification(gc *gin.Context) {
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Hospitals are in Korea. Opening hours are in Seoul time.
+var seoul = loadSeoul()
+
+func loadSeoul() *time.Location {
+	location, err := time.LoadLocation("Asia/Seoul")
+	if err != nil {
+		return time.FixedZone("KST", 9*60*60)
+	}
+	return location
+}
+
+// Times are "15:04". Close may be past "24:00" when open overnight.
+var hourPattern = regexp.MustCompile(`^([0-3][0-9]):([0-5][0-9])$`)
+
+const dateLayout = "2006-01-02"
+
+// Days looked ahead for when a hospital opens next.
+const opensAtDays = 7
+
+// OpeningHours of a hospital on a day of week.
+type OpeningHours struct {
+	Day        int    `json:"day"`                                               // 0 for Sunday as time.Weekday
+	Open       string `json:"open"`                                              // 09:00
+	Close      string `json:"close"`                                             // 18:00
+	BreakStart string `bson:"breakstart,omitempty" json:"break_start,omitempty"` // Lunch break 13:00
+	BreakEnd   string `bson:"breakend,omitempty" json:"break_end,omitempty"`     // 14:00
+}
+
+// HolidayHours overrides opening hours on a date.
+type HolidayHours struct {
+	Date   string `json:"date"` // 2006-01-02
+	Closed bool   `json:"closed"`
+	Open   string `bson:",omitempty" json:"open,omitempty"`
+	Close  string `bson:",omitempty" json:"close,omitempty"`
+	Note   string `bson:",omitempty" json:"note,omitempty"` // 추석 연휴
+}
+
+func validateHours(open, close, breakStart, breakEnd string) error {
+	if hourPattern.MatchString(open) == false || open >= "24:00" {
+		return errors.New("Invalid open of opening hours.")
+	}
+	if hourPattern.MatchString(close) == false || close <= open || close > "48:00" {
+		return errors.New("Invalid close of opening hours.")
+	}
+
+	if breakStart == "" && breakEnd == "" {
+		return nil
+	}
+	if hourPattern.MatchString(breakStart) == false || hourPattern.MatchString(breakEnd) == false ||
+		breakStart <= open || breakEnd <= breakStart || breakEnd >= close {
+		return errors.New("Invalid break of opening hours.")
+	}
+	return nil
+}
+
+func (i *OpeningHours) Validate() error {
+	if i.Day < 0 || i.Day > 6 {
+		return errors.New("Invalid day of opening hours.")
+	}
+	return validateHours(i.Open, i.Close, i.BreakStart, i.BreakEnd)
+}
+
+func (i *HolidayHours) Validate() error {
+	if _, err := time.Parse(dateLayout, i.Date); err != nil {
+		return errors.New("Invalid date of holiday hours.")
+	}
+	if i.Closed {
+		return nil
+	}
+	return validateHours(i.Open, i.Close, "", "")
+}
+
+// minutes returns minutes from midnight of "15:04".
+func minutes(hour string) int {
+	if len(hour) != 5 {
+		return 0
+	}
+	h, _ := strconv.Atoi(hour[:2])
+	m, _ := strconv.Atoi(hour[3:])
+	return h*60 + m
+}
+
+// openInterval is a time a hospital is open from start until end.
+type openInterval struct {
+	start, end time.Time
+}
+
+// intervals returns when open from open to close on date, except the break.
+func intervals(date time.Time, open, close, breakStart, breakEnd string) []openInterval {
+	at := func(hour string) time.Time {
+		return date.Add(time.Duration(minutes(hour)) * time.Minute)
+	}
+
+	if breakStart == "" {
+		return []openInterval{{at(open), at(close)}}
+	}
+	return []openInterval{{at(open), at(breakStart)}, {at(breakEnd), at(close)}}
+}
+
+func (i *Hospital) holiday(date string) *HolidayHours {
+	for n := range i.Holidays {
+		if i.Holidays[n].Date == date {
+			return &i.Holidays[n]
+		}
+	}
+	return nil
+}
+
+// openIntervals returns when the hospital is open starting on date, a
+// midnight in Seoul.
+func (i *Hospital) openIntervals(date time.Time) []openInterval {
+	if holiday := i.holiday(date.Format(dateLayout)); holiday != nil {
+		if holiday.Closed {
+			return nil
+		}
+		return intervals(date, holiday.Open, holiday.Close, "", "")
+	}
+
+	if i.Is24Hours {
+		return []openInterval{{date, date.AddDate(0, 0, 1)}}
+	}
+
+	var open []openInterval
+	for _, hours := range i.Hours {
+		if hours.Day == int(date.Weekday()) {
+			open = append(open, intervals(date, hours.Open, hours.Close, hours.BreakStart, hours.BreakEnd)...)
+		}
+	}
+	return open
+}
+
+// SetOpenStatus sets IsOpen, and ClosesAt or OpensAt at t.
+func (i *Hospital) SetOpenStatus(t time.Time) {
+	t = t.In(seoul)
+	today := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, seoul)
+
+	// From yesterday for hours past midnight
+	var open []openInterval
+	for n := -1; n <= opensAtDays; n++ {
+		open = append(open, i.openIntervals(today.AddDate(0, 0, n))...)
+	}
+
+	i.IsOpen, i.OpensAt, i.ClosesAt = false, nil, nil
+	for _, interval := range open {
+		if interval.start.After(t) == false && interval.end.After(t) {
+			i.IsOpen = true
+			closesAt := interval.end
+
+			// Open on until the next interval
+			for extended := true; extended; {
+				extended = false
+				for _, next := range open {
+					if next.start.After(closesAt) == false && next.end.After(closesAt) {
+						closesAt = next.end
+						extended = true
+					}
+				}
+			}
+
+			if closesAt.Before(today.AddDate(0, 0, opensAtDays)) {
+				i.ClosesAt = &closesAt
+			}
+			return
+		}
+
+		if interval.start.After(t) && (i.OpensAt == nil || interval.start.Before(*i.OpensAt)) {
+			opensAt := interval.start
+			i.OpensAt = &opensAt
+		}
+	}
+}
+
+func setHospitalsOpenStatus(hospitals []Hospital, t time.Time) {
+	for n := range hospitals {
+		hospitals[n].SetOpenStatus(t)
+	}
+}
+
+// openAtQuery matches hospitals open at t. Hours are compared as strings
+// since they are zero padded.
+func openAtQuery(t time.Time) bson.M {
+	t = t.In(seoul)
+	day := int(t.Weekday())
+	date := t.Format(dateLayout)
+	now := t.Format("15:04")
+
+	// Still open from the day before
+	yesterday := (day + 6) % 7
+	yesterdayDate := t.AddDate(0, 0, -1).Format(dateLayout)
+	lateNight := fmt.Sprintf("%02d:%02d", t.Hour()+24, t.Minute())
+
+	notOnBreak := []bson.M{
+		{"breakstart": bson.M{"$exists": false}},
+		{"breakstart": bson.M{"$gt": now}},
+		{"breakend": bson.M{"$lte": now}},
+	}
+
+	return bson.M{"$or": []bson.M{
+		{"is24hours": true, "holidays.date": bson.M{"$ne": date}},
+		{"holidays.date": bson.M{"$ne": date}, "hours": bson.M{"$elemMatch": bson.M{
+			"day":   day,
+			"open":  bson.M{"$lte": now},
+			"close": bson.M{"$gt": now},
+			"$or":   notOnBreak,
+		}}},
+		{"holidays.date": bson.M{"$ne": yesterdayDate}, "hours": bson.M{"$elemMatch": bson.M{
+			"day":   yesterday,
+			"close": bson.M{"$gt": lateNight},
+		}}},
+		{"holidays": bson.M{"$elemMatch": bson.M{
+			"date":   date,
+			"closed": false,
+			"open":   bson.M{"$lte": now},
+			"close":  bson.M{"$gt": now},
+		}}},
+		{"holidays": bson.M{"$elemMatch": bson.M{
+			"date":   yesterdayDate,
+			"closed": false,
+			"close":  bson.M{"$gt": lateNight},
+		}}},
+	}}
+}
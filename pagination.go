@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const DefaultPageLimit = 20
+const MaxPageLimit = 100
+
+// SortKey is a field that lists can be sorted and paged on.
+type SortKey struct {
+	Field  string // Field name in DB
+	IsTime bool
+}
+
+var SortKeyCreated = SortKey{Field: "created", IsTime: true}
+
+// Cursor marks the last item of a page. Clients get it as an opaque string
+// in "next_cursor" and send it back as the "cursor" query value.
+type Cursor struct {
+	Time   time.Time     `json:"t,omitempty"`
+	Number float64       `json:"n,omitempty"`
+	Id     bson.ObjectId `json:"i"`
+}
+
+// Page holds the cursor, limit and order of a list request.
+type Page struct {
+	Cursor    Cursor
+	HasCursor bool
+	Limit     int
+	Key       SortKey
+	Desc      bool
+}
+
+func NewCursor(value interface{}, id bson.ObjectId) Cursor {
+	cursor := Cursor{Id: id}
+	switch v := value.(type) {
+	case time.Time:
+		cursor.Time = v
+	case int:
+		cursor.Number = float64(v)
+	case float64:
+		cursor.Number = v
+	}
+	return cursor
+}
+
+func (c Cursor) Encode() string {
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func DecodeCursor(str string) (cursor Cursor, err error) {
+	buf, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return cursor, errors.New("Invalid Cursor")
+	}
+
+	if err = json.Unmarshal(buf, &cursor); err != nil || cursor.Id.Valid() == false {
+		return cursor, errors.New("Invalid Cursor")
+	}
+
+	return cursor, nil
+}
+
+// parseSort reads sort value like "-created" and returns matching key in keys.
+func parseSort(sort string, keys map[string]SortKey) (key SortKey, desc bool, err error) {
+	desc = strings.HasPrefix(sort, "-")
+	key, ok := keys[strings.TrimPrefix(sort, "-")]
+	if ok == false {
+		return key, desc, errors.New("Invalid sort: " + sort)
+	}
+	return key, desc, nil
+}
+
+// getPageFromQuery reads "cursor" and "limit" from query string.
+// Limit is capped at MaxPageLimit. Responds on its own when cursor is invalid.
+func getPageFromQuery(gc *gin.Context, defaultLimit int, key SortKey, desc bool) (page Page, err error) {
+	page.Key = key
+	page.Desc = desc
+	page.Limit = defaultLimit
+
+	if limit, err := strconv.Atoi(gc.Query("limit")); err == nil && limit > 0 {
+		page.Limit = limit
+	}
+
+	if page.Limit > MaxPageLimit {
+		page.Limit = MaxPageLimit
+	}
+
+	cursorStr := gc.Query("cursor")
+	if cursorStr == "" {
+		return page, nil
+	}
+
+	if page.Cursor, err = DecodeCursor(cursorStr); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Invalid cursor."})
+		return page, err
+	}
+	page.HasCursor = true
+
+	return page, nil
+}
+
+func (p *Page) cursorValue() interface{} {
+	if p.Key.IsTime {
+		return p.Cursor.Time
+	}
+	return p.Cursor.Number
+}
+
+// Query adds condition to query so that only items after the cursor
+// are matched. Use it together with Sort.
+func (p *Page) Query(query bson.M) bson.M {
+	if p.HasCursor == false {
+		return query
+	}
+
+	op := "$gt"
+	if p.Desc {
+		op = "$lt"
+	}
+
+	after := []bson.M{
+		{p.Key.Field: bson.M{op: p.cursorValue()}},
+		{p.Key.Field: p.cursorValue(), "_id": bson.M{op: p.Cursor.Id}},
+	}
+
+	// Query may already have $or from filters.
+	if or, ok := query["$or"]; ok {
+		delete(query, "$or")
+		query["$and"] = []bson.M{{"$or": or}, {"$or": after}}
+		return query
+	}
+
+	query["$or"] = after
+	return query
+}
+
+func (p *Page) Sort() []string {
+	if p.Desc {
+		return []string{"-" + p.Key.Field, "-_id"}
+	}
+	return []string{p.Key.Field, "_id"}
+}
+
+// DistanceMatch is the $match stage following $geoNear for items after the cursor.
+func (p *Page) DistanceMatch() bson.M {
+	return bson.M{"$or": []bson.M{
+		{"distance": bson.M{"$gt": p.Cursor.Number}},
+		{"distance": p.Cursor.Number, "_id": bson.M{"$gt": p.Cursor.Id}},
+	}}
+}
+
+// QueryLimit is one more than Limit to find out if there is a next page.
+func (p *Page) QueryLimit() int {
+	return p.Limit + 1
+}
+
+// HasMore reports whether n fetched rows had more than a page.
+func (p *Page) HasMore(n int) bool {
+	return n > p.Limit
+}
@@ -32,6 +32,14 @@ func init() {
 		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
 		panic(err)
 	}
+
+	// Settings saved before GetFollows existed get pushes like new ones.
+	if _, err := dbcPushSettings.UpdateAll(
+		bson.M{"getfollows": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"getfollows": true}},
+	); err != nil {
+		log.Print(err)
+	}
 }
 
 // PushSetting for reviews
@@ -41,6 +49,7 @@ type PushSetting struct {
 	IsPushOn    bool          `json:"ispushon"`
 	GetLikes    bool          `json:"getlikes"`
 	GetComments bool          `json:"getcomments"`
+	GetFollows  bool          `json:"getfollows"` // Reviews of followed users and hospitals
 	Updated     time.Time     `json:"-"`
 }
 
@@ -120,6 +129,7 @@ func upsertPushSetting(gc *gin.Context) {
 		IsPushOn:    true,
 		GetLikes:    true,
 		GetComments: true,
+		GetFollows:  true,
 	}
 
 	if err := gc.BindJSON(&pushSetting); err != nil {
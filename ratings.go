@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	MinRating = 1
+	MaxRating = 5
+)
+
+// Rating of a hospital given in a review. Overall is required, other
+// dimensions are 0 when not rated.
+type Rating struct {
+	Overall     int `bson:"overall" json:"overall"`
+	Price       int `bson:"price,omitempty" json:"price,omitempty"`
+	Kindness    int `bson:"kindness,omitempty" json:"kindness,omitempty"`
+	Explanation int `bson:"explanation,omitempty" json:"explanation,omitempty"`
+	Facility    int `bson:"facility,omitempty" json:"facility,omitempty"`
+}
+
+// HospitalRating is the aggregate of ratings in published reviews of a hospital.
+type HospitalRating struct {
+	Count        int     `bson:"count" json:"count"`
+	Average      float64 `bson:"average" json:"average"` // of Overall
+	Price        float64 `bson:"price" json:"price"`
+	Kindness     float64 `bson:"kindness" json:"kindness"`
+	Explanation  float64 `bson:"explanation" json:"explanation"`
+	Facility     float64 `bson:"facility" json:"facility"`
+	Distribution []int   `bson:"distribution" json:"distribution"` // Count of Overall from 1 to 5 stars
+}
+
+// Validate checks every rated dimension is in range. No rating is valid.
+func (r *Rating) Validate() error {
+	if r == nil {
+		return nil
+	}
+
+	if r.Overall < MinRating || r.Overall > MaxRating {
+		return errors.New("Invalid overall rating.")
+	}
+
+	for _, value := range []int{r.Price, r.Kindness, r.Explanation, r.Facility} {
+		if value != 0 && (value < MinRating || value > MaxRating) {
+			return errors.New("Invalid rating.")
+		}
+	}
+
+	return nil
+}
+
+func NewHospitalRating() HospitalRating {
+	return HospitalRating{Distribution: make([]int, MaxRating)}
+}
+
+// UpdateRating aggregates ratings of published reviews of the hospital and
+// saves the result.
+func (i *Hospital) UpdateRating() error {
+	group := bson.M{
+		"_id":         nil,
+		"count":       bson.M{"$sum": 1},
+		"average":     bson.M{"$avg": "$rating.overall"},
+		"price":       bson.M{"$avg": "$rating.price"},
+		"kindness":    bson.M{"$avg": "$rating.kindness"},
+		"explanation": bson.M{"$avg": "$rating.explanation"},
+		"facility":    bson.M{"$avg": "$rating.facility"},
+	}
+	for star := MinRating; star <= MaxRating; star++ {
+		group[starField(star)] = bson.M{
+			"$sum": bson.M{"$cond": []interface{}{bson.M{"$eq": []interface{}{"$rating.overall", star}}, 1, 0}},
+		}
+	}
+
+	var results []bson.M
+	if err := dbcReviews.Pipe([]bson.M{
+		{"$match": bson.M{
+			"hospitalid":     i.Id,
+			"isdraft":        false,
+			"isdeleted":      false,
+			"issuspended":    false,
+			"ispending":      bson.M{"$ne": true},
+			"rating.overall": bson.M{"$gte": MinRating},
+		}},
+		{"$group": group},
+	}).All(&results); err != nil {
+		return err
+	}
+
+	rating := NewHospitalRating()
+	if len(results) > 0 {
+		result := results[0]
+		rating.Count = toInt(result["count"])
+		rating.Average = toFloat(result["average"])
+		rating.Price = toFloat(result["price"])
+		rating.Kindness = toFloat(result["kindness"])
+		rating.Explanation = toFloat(result["explanation"])
+		rating.Facility = toFloat(result["facility"])
+		for star := MinRating; star <= MaxRating; star++ {
+			rating.Distribution[star-1] = toInt(result[starField(star)])
+		}
+	}
+
+	if err := dbcHospitals.UpdateId(i.Id, bson.M{"$set": bson.M{"rating": rating}}); err != nil {
+		return err
+	}
+
+	i.Rating = rating
+	return nil
+}
+
+func starField(star int) string {
+	return "star" + strconv.Itoa(star)
+}
+
+// Numbers from aggregation may be int, int64 or float64. null is 0.
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+func toInt(value interface{}) int {
+	return int(toFloat(value))
+}
+
+// updateHospitalRatings updates ratings of hospitals a review was or is at.
+func updateHospitalRatings(hospitalIds ...bson.ObjectId) {
+	for _, id := range hospitalIds {
+		if id.Valid() == false {
+			continue
+		}
+
+		hospital := Hospital{Id: id}
+		if err := hospital.UpdateRating(); err != nil {
+			log.Printf("Could not update rating of hospital %s. %s", id.Hex(), err.Error())
+		}
+	}
+}
+
+// backfillHospitalRatings sets an empty rating on hospitals saved before it
+// existed, so they can be sorted by rating.
+func backfillHospitalRatings() {
+	if _, err := dbcHospitals.UpdateAll(
+		bson.M{"rating": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"rating": NewHospitalRating()}},
+	); err != nil {
+		log.Print(err)
+	}
+}
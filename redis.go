@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"gopkg.in/redis.v3"
 	"log"
+	"time"
 )
 
 var client *redis.Client
@@ -64,3 +66,42 @@ func exampleClient() {
 	// Output: key value
 	// key2 does not exists
 }
+
+// getCache reads value cached at key into v. Returns false when not cached or
+// Redis is not available.
+func getCache(key string, v interface{}) bool {
+	if client == nil {
+		return false
+	}
+
+	buf, err := client.Get(key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Print(err)
+		}
+		return false
+	}
+
+	if err := json.Unmarshal(buf, v); err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
+
+// setCache caches v at key for expiration.
+func setCache(key string, v interface{}, expiration time.Duration) {
+	if client == nil {
+		return
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	if err := client.Set(key, buf, expiration).Err(); err != nil {
+		log.Print(err)
+	}
+}
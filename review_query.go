@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Earth radius in meters used by MongoDB for spherical geometry.
+const EarthRadius = 6378100.0
+
+var sortKeyDistance = SortKey{Field: "distance"}
+
+// Sortable fields of reviews. Keys are the values accepted in "sort".
+var reviewSortKeys = map[string]SortKey{
+	"created":    SortKeyCreated,
+	"likes":      {Field: "likecount"},
+	"cost":       {Field: "cost"},
+	"visit_time": {Field: "visittime", IsTime: true},
+	"rating":     {Field: "rating.overall"},
+	"distance":   sortKeyDistance,
+}
+
+// ReviewQuery builds the filter and order of a review list.
+type ReviewQuery struct {
+	Filter bson.M
+	Key    SortKey
+	Desc   bool
+	Near   *NearRequest
+	Box    *BoundingBox
+}
+
+func NewReviewQuery() ReviewQuery {
+	return ReviewQuery{
+		Filter: bson.M{
+			"isdraft":     false,
+			"isdeleted":   false,
+			"issuspended": false,
+			"ispending":   bson.M{"$ne": true},
+		},
+		Key:  SortKeyCreated,
+		Desc: true,
+	}
+}
+
+func (rq *ReviewQuery) SetSort(sort string) error {
+	key, desc, err := parseSort(sort, reviewSortKeys)
+	if err != nil {
+		return err
+	}
+
+	if key == sortKeyDistance && rq.Near == nil {
+		return errors.New("Sort by distance requires location")
+	}
+
+	rq.Key = key
+	rq.Desc = desc
+
+	// Cost, visit time and rating are not set on every review. Paging over
+	// a missing field does not work, so only reviews having it are listed.
+	if key.Field == "cost" || key.Field == "visittime" || key.Field == "rating.overall" {
+		rq.Range(key.Field, "$exists", true)
+	}
+
+	return nil
+}
+
+// SetNear sorts reviews by distance from near. When sorted by another key,
+// reviews are limited to the circle of near.Distance meters instead.
+func (rq *ReviewQuery) SetNear(near NearRequest) {
+	rq.Near = &near
+	rq.Key = sortKeyDistance
+	rq.Desc = false
+}
+
+// Within limits reviews to the box. The circle of near.Distance does not
+// apply then.
+func (rq *ReviewQuery) Within(box BoundingBox) {
+	rq.Box = &box
+	rq.Filter["location"] = box.Query()
+}
+
+// Query returns the filter including location when not sorted by distance.
+func (rq *ReviewQuery) Query() bson.M {
+	if rq.Near == nil || rq.Key == sortKeyDistance || rq.Near.Distance <= 0 || rq.Box != nil {
+		return rq.Filter
+	}
+
+	query := bson.M{}
+	for k, v := range rq.Filter {
+		query[k] = v
+	}
+	query["location"] = bson.M{
+		"$geoWithin": bson.M{
+			"$centerSphere": []interface{}{
+				[]float64{rq.Near.Longitude, rq.Near.Latitude},
+				rq.Near.Distance / EarthRadius,
+			},
+		},
+	}
+	return query
+}
+
+func (rq *ReviewQuery) Categories(categories []string) {
+	rq.Filter["categories"] = bson.M{"$in": categories}
+}
+
+func (rq *ReviewQuery) Parts(parts []string) {
+	rq.Filter["parts"] = bson.M{"$in": parts}
+}
+
+func (rq *ReviewQuery) PetType(petType int) {
+	rq.Filter["pettype"] = petType
+}
+
+func (rq *ReviewQuery) PetSizes(sizes []int) {
+	rq.Filter["petsize"] = bson.M{"$in": sizes}
+}
+
+func (rq *ReviewQuery) Hospital(id bson.ObjectId) {
+	rq.Filter["hospitalid"] = id
+}
+
+// Region matches reviews in the region named like "강남구".
+func (rq *ReviewQuery) Region(name string) {
+	for k, v := range regionQuery(name) {
+		rq.Filter[k] = v
+	}
+}
+
+func (rq *ReviewQuery) User(id bson.ObjectId) {
+	rq.Filter["userid"] = id
+}
+
+// Range adds a comparison like "$gte" to field.
+func (rq *ReviewQuery) Range(field string, op string, value interface{}) {
+	cond, ok := rq.Filter[field].(bson.M)
+	if ok == false {
+		cond = bson.M{}
+		rq.Filter[field] = cond
+	}
+	cond[op] = value
+}
+
+// Parse reads sort and filters from query string.
+// Responds on its own when a value is invalid.
+//
+//	sort         created, likes, cost, visit_time, rating or distance. "-" for descending.
+//	category     Comma separated categories. Matches any.
+//	parts        Comma separated parts. Matches any.
+//	pet_type     Pet type
+//	pet_size     Comma separated pet sizes
+//	pet_age_min, pet_age_max
+//	cost_min, cost_max
+//	hospitalid
+//	region       Region like "강남구" or "서울 중구"
+//	visit_from, visit_to   Date as 2006-01-02
+//	latitude, longitude, distance   Distance in meters
+//	bbox         west,south,east,north of a map viewport. Instead of distance.
+func (rq *ReviewQuery) Parse(gc *gin.Context) (err error) {
+	defer func() {
+		if err != nil {
+			log.Print(err)
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		}
+	}()
+
+	if gc.Query("latitude") != "" || gc.Query("longitude") != "" {
+		var near NearRequest
+		if near.Latitude, err = queryFloat(gc, "latitude"); err != nil {
+			return
+		}
+		if near.Longitude, err = queryFloat(gc, "longitude"); err != nil {
+			return
+		}
+		if gc.Query("distance") != "" {
+			if near.Distance, err = queryFloat(gc, "distance"); err != nil {
+				return
+			}
+		}
+
+		rq.SetNear(near)
+	}
+
+	if str := gc.Query("bbox"); str != "" {
+		var box BoundingBox
+		if box, err = parseBoundingBox(str); err != nil {
+			return
+		}
+		rq.Within(box)
+	}
+
+	if sort := gc.Query("sort"); sort != "" {
+		if err = rq.SetSort(sort); err != nil {
+			return
+		}
+	}
+
+	if str := gc.Query("category"); str != "" {
+		rq.Categories(strings.Split(str, ","))
+	}
+
+	if region := strings.TrimSpace(gc.Query("region")); region != "" {
+		rq.Region(region)
+	}
+
+	if str := gc.Query("parts"); str != "" {
+		rq.Parts(strings.Split(str, ","))
+	}
+
+	if str := gc.Query("pet_type"); str != "" {
+		petType, err := strconv.Atoi(str)
+		if err != nil {
+			return errors.New("Invalid pet_type.")
+		}
+		rq.PetType(petType)
+	}
+
+	if str := gc.Query("pet_size"); str != "" {
+		var sizes []int
+		for _, sizeStr := range strings.Split(str, ",") {
+			size, err := strconv.Atoi(sizeStr)
+			if err != nil {
+				return errors.New("Invalid pet_size.")
+			}
+			sizes = append(sizes, size)
+		}
+		rq.PetSizes(sizes)
+	}
+
+	ranges := []struct {
+		param string
+		field string
+		op    string
+	}{
+		{"pet_age_min", "petage", "$gte"},
+		{"pet_age_max", "petage", "$lte"},
+		{"cost_min", "cost", "$gte"},
+		{"cost_max", "cost", "$lte"},
+	}
+	for _, r := range ranges {
+		if str := gc.Query(r.param); str != "" {
+			value, err := strconv.Atoi(str)
+			if err != nil {
+				return errors.New("Invalid " + r.param + ".")
+			}
+			rq.Range(r.field, r.op, value)
+		}
+	}
+
+	if str := gc.Query("hospitalid"); str != "" {
+		if bson.IsObjectIdHex(str) == false {
+			return errors.New("Invalid hospitalid.")
+		}
+		rq.Hospital(bson.ObjectIdHex(str))
+	}
+
+	if str := gc.Query("visit_from"); str != "" {
+		from, err := time.Parse("2006-01-02", str)
+		if err != nil {
+			return errors.New("Invalid visit_from.")
+		}
+		rq.Range("visittime", "$gte", from)
+	}
+
+	if str := gc.Query("visit_to"); str != "" {
+		to, err := time.Parse("2006-01-02", str)
+		if err != nil {
+			return errors.New("Invalid visit_to.")
+		}
+		// Up to the end of the day
+		rq.Range("visittime", "$lt", to.AddDate(0, 0, 1))
+	}
+
+	return nil
+}
+
+func queryFloat(gc *gin.Context, name string) (float64, error) {
+	value, err := strconv.ParseFloat(gc.Query(name), 64)
+	if err != nil {
+		return 0, errors.New("Invalid " + name + ".")
+	}
+	return value, nil
+}
+
+// listReviews responds with a page of reviews matching rq to the user viewerId.
+// Each review has its distance in meters when rq is near a location.
+func listReviews(gc *gin.Context, rq ReviewQuery, defaultLimit int, viewerId bson.ObjectId) {
+	page, err := getPageFromQuery(gc, defaultLimit, rq.Key, rq.Desc)
+	if err != nil {
+		return
+	}
+
+	var reviews interface{}
+	var count int
+	var nextCursor string
+	var hasMore bool
+
+	if rq.Key == sortKeyDistance {
+		var nearby []ReviewNearby
+		if err := dbcReviews.Pipe(reviewsNearPipeline(*rq.Near, page, rq.Query())).All(&nearby); err != nil {
+			log.Print(err)
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error get data from DB."})
+			return
+		}
+
+		if hasMore = page.HasMore(len(nearby)); hasMore {
+			nearby = nearby[:page.Limit]
+			last := nearby[len(nearby)-1]
+			nextCursor = NewCursor(last.Distance, last.Id).Encode()
+		}
+		for n := range nearby {
+			nearby[n].SetViewer(viewerId)
+		}
+		reviews, count = nearby, len(nearby)
+
+	} else {
+		var found []Review
+		query := page.Query(rq.Query())
+		if err := dbcReviews.Find(query).Sort(page.Sort()...).Limit(page.QueryLimit()).All(&found); err != nil {
+			log.Print(err)
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error get data from DB."})
+			return
+		}
+
+		found, nextCursor, hasMore = pageReviews(found, page)
+		setReviewsViewer(found, viewerId)
+		reviews, count = found, len(found)
+
+		// Distance is of each review when listed near a location.
+		if rq.Near != nil {
+			nearby := make([]ReviewNearby, 0, len(found))
+			for _, review := range found {
+				item := ReviewNearby{Review: review}
+				item.SetDistance(*rq.Near)
+				nearby = append(nearby, item)
+			}
+			reviews = nearby
+		}
+	}
+
+	if count == 0 {
+		log.Print("No Reviews")
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No reviews.", "has_more": false})
+		return
+	}
+
+	log.Println("Fetched " + strconv.Itoa(count) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully fetched Reviews.",
+		"reviews":     reviews,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
+}
+
+// pageReviews trims reviews fetched with page.QueryLimit() down to a page
+// and returns the cursor for the next page.
+func pageReviews(reviews []Review, page Page) ([]Review, string, bool) {
+	if page.HasMore(len(reviews)) == false {
+		return reviews, "", false
+	}
+
+	reviews = reviews[:page.Limit]
+	last := reviews[len(reviews)-1]
+	return reviews, NewCursor(last.SortValue(page.Key), last.Id).Encode(), true
+}
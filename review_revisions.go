@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const TableNameReviewRevisions = "review_revisions"
+
+var dbcReviewRevisions *mgo.Collection
+
+func init() {
+	const tableName = TableNameReviewRevisions
+	dbcReviewRevisions = dbSession.DB(dbName).C(tableName)
+	dbCols[tableName] = dbcReviewRevisions
+
+	index := mgo.Index{
+		Key:        []string{"reviewid", "-created"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+}
+
+// ReviewContent is the part of a Review that its owner can edit.
+type ReviewContent struct {
+	ReviewBody   string          `json:"reviewbody"`
+	HospitalId   bson.ObjectId   `bson:"hospitalid,omitempty" json:"hospitalid,omitempty"`
+	HospitalName string          `bson:"hospital,omitempty" json:"hospital_name"`
+	VisitTime    time.Time       `bson:",omitempty" json:"visit_time,omitempty"`
+	Categories   []string        `bson:",omitempty" json:"categories,omitempty"`
+	Parts        []string        `bson:",omitempty" json:"parts,omitempty"`
+	Cost         int             `bson:",omitempty" json:"cost"`
+	Rating       *Rating         `bson:"rating,omitempty" json:"rating,omitempty"`
+	IsAnonymous  *bool           `bson:"isanonymous,omitempty" json:"isanonymous,omitempty"` // Kept as it is when nil
+	Images       []bson.ObjectId `bson:",omitempty" json:"images,omitempty"`
+}
+
+// ReviewRevision keeps the content of a review before it was edited.
+type ReviewRevision struct {
+	Id       bson.ObjectId `bson:"_id" json:"id"`
+	ReviewId bson.ObjectId `json:"reviewid"`
+	UserId   bson.ObjectId `json:"userid"` // Who edited
+	Content  ReviewContent `json:"content"`
+	Created  time.Time     `json:"created"` // When it was edited
+}
+
+func (i *Review) Content() ReviewContent {
+	isAnonymous := i.IsAnonymous
+	return ReviewContent{
+		ReviewBody:   i.ReviewBody,
+		HospitalId:   i.HospitalId,
+		HospitalName: i.HospitalName,
+		VisitTime:    i.VisitTime,
+		Categories:   i.Categories,
+		Parts:        i.Parts,
+		Cost:         i.Cost,
+		Rating:       i.Rating,
+		IsAnonymous:  &isAnonymous,
+		Images:       i.Images,
+	}
+}
+
+func (i *Review) SetContent(content ReviewContent) {
+	i.ReviewBody = content.ReviewBody
+	i.HospitalId = content.HospitalId
+	i.HospitalName = content.HospitalName
+	i.VisitTime = content.VisitTime
+	i.Categories = content.Categories
+	i.Parts = content.Parts
+	i.Cost = content.Cost
+	i.Rating = content.Rating
+	if content.IsAnonymous != nil {
+		i.IsAnonymous = *content.IsAnonymous
+	}
+	// Images are added by uploading. Kept as they are when nil.
+	if content.Images != nil {
+		i.Images = content.Images
+	}
+}
+
+// LocateAt sets location of the review to the hospital's.
+func (i *Review) LocateAt(hospitalId bson.ObjectId) error {
+	if hospitalId.Valid() == false {
+		return nil
+	}
+
+	var hospital Hospital
+	if err := hospital.GetById(hospitalId); err != nil {
+		return err
+	}
+
+	i.Location = hospital.Location
+	return nil
+}
+
+// Validate checks posted content of review before it is published.
+func (content *ReviewContent) Validate(review *Review) error {
+	if content.ReviewBody == "" {
+		return errors.New("Review body is required.")
+	}
+
+	if content.Cost < 0 {
+		return errors.New("Invalid cost.")
+	}
+
+	if err := content.Rating.Validate(); err != nil {
+		return err
+	}
+
+	if content.HospitalId.Valid() {
+		n, err := dbcHospitals.FindId(content.HospitalId).Count()
+		if err != nil || n == 0 {
+			return errors.New("Invalid hospital.")
+		}
+	}
+
+	return content.ValidateImages(review)
+}
+
+// ValidateImages checks that images are uploaded for the review by its owner.
+func (content *ReviewContent) ValidateImages(review *Review) error {
+	for _, imageId := range content.Images {
+		var image Image
+		if err := image.GetById(imageId); err != nil {
+			return errors.New("Invalid image.")
+		}
+
+		if image.UserId != review.UserId || image.Category != "review" || image.RelatedId != review.Id {
+			return errors.New("Invalid image.")
+		}
+	}
+
+	return nil
+}
+
+////////////////////////      BASIC OPERATIONS     ///////////////////////////
+
+func (i *ReviewRevision) Insert() (bson.ObjectId, error) {
+	if i.Id.Valid() == false {
+		i.Id = bson.NewObjectId()
+	}
+
+	if i.Created.IsZero() {
+		i.Created = time.Now()
+	}
+
+	if err := dbcReviewRevisions.Insert(&i); err != nil {
+		log.Println("Could not insert a review revision.")
+		return i.Id, err
+	}
+
+	return i.Id, nil
+}
+
+// Edit saves current content of the review as a revision and replaces it.
+func (i *Review) Edit(editorId bson.ObjectId, content ReviewContent) (err error) {
+	revision := ReviewRevision{
+		ReviewId: i.Id,
+		UserId:   editorId,
+		Content:  i.Content(),
+	}
+
+	if _, err = revision.Insert(); err != nil {
+		return err
+	}
+
+	if content.HospitalId != i.HospitalId {
+		if err = i.LocateAt(content.HospitalId); err != nil {
+			return err
+		}
+	}
+
+	oldHospitalId := i.HospitalId
+	i.SetContent(content)
+
+	fields := []string{"isedited", "edited"}
+	if content.Images != nil {
+		fields = append(fields, "images")
+	}
+
+	// The response was of the hospital the review was about.
+	if oldHospitalId != i.HospitalId {
+		i.Response = nil
+		fields = append(fields, "response")
+	}
+	i.IsEdited = true
+	i.Edited = revision.Created
+
+	if err = i.saveContent(fields...); err != nil {
+		return err
+	}
+
+	if oldHospitalId != i.HospitalId {
+		updateHospitalRatings(oldHospitalId, i.HospitalId)
+	} else {
+		updateHospitalRatings(i.HospitalId)
+	}
+	return nil
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+func getReviewRevisions(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	reviewId, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var review Review
+	if err := review.GetById(reviewId); err != nil {
+		DataNotFound(gc)
+		return
+	}
+
+	var revisions []ReviewRevision
+	if err := dbcReviewRevisions.Find(bson.M{"reviewid": review.Id}).Sort("-created").All(&revisions); err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(revisions)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":    0,
+		"message":   "Successfully fetched Revisions.",
+		"review":    review,
+		"revisions": revisions,
+	})
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -49,79 +48,204 @@ func init() {
 		panic(err)
 	}
 
+	index = mgo.Index{
+		Key:        []string{"hospitalid", "-created"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	index = mgo.Index{
+		Key:        []string{"region.names", "-created"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	index = mgo.Index{
+		Key:        []string{"ip", "-created"},
+		Unique:     false,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	index = mgo.Index{
+		Key:        []string{"shareslug"},
+		Unique:     true,
+		DropDups:   false,
+		Background: true,
+		Sparse:     true,
+	}
+
+	if err := dbCols[tableName].EnsureIndex(index); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	for _, key := range []string{"likecount", "cost", "visittime", "rating.overall"} {
+		index = mgo.Index{
+			Key:        []string{key, "_id"},
+			Unique:     false,
+			DropDups:   false,
+			Background: true,
+			Sparse:     false,
+		}
+
+		if err := dbCols[tableName].EnsureIndex(index); err != nil {
+			log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+			panic(err)
+		}
+	}
+
+	if err := dbCols[tableName].EnsureIndex(searchTextIndex); err != nil {
+		log.Printf("Error while ensuring index for '%s'. %s", tableName, err.Error())
+		panic(err)
+	}
+
+	backfillLikeCount(dbcReviews)
 }
 
+// Shown instead of the nickname of anonymous authors.
+const AnonymousNickname = "익명"
+
 // Review for review
 type Review struct {
-	Id           bson.ObjectId   `bson:"_id" json:"id"`
-	UserId       bson.ObjectId   `json:"userid"`
-	PetId        bson.ObjectId   `json:"petid" binding:"required"`
-	PetType      int             `json:"pet_type"`
-	PetAge       int             `json:"pet_age"`
-	PetSize      int             `json:"pet_size"`
-	HospitalId   bson.ObjectId   `bson:"hospitalid,omitempty" json:"hospitalid,omitempty"`
-	HospitalName string          `bson:"hospital,omitempty" json:"hospital_name"`
-	Location     GeoJson         `bson:"location" json:"location,omitempty"`
-	LocationName string          `bson:",omitempty" json:"location_name"`
-	VisitTime    time.Time       `bson:",omitempty" json:"visit_time,omitempty"`
-	Category     string          `bson:",omitempty" json:"category,omitempty"`
-	Categories   []string        `bson:",omitempty" json:"categories,omitempty"`
-	Parts        []string        `bson:",omitempty" json:"parts,omitempty"`
-	Cost         int             `bson:",omitempty" json:"cost"`
-	ReviewBody   string          `json:"reviewbody" binding:"required"`
-	Images       []bson.ObjectId `bson:"images" json:"images,omitempty"`
-	Likes        []bson.ObjectId `bson:"likes" json:"likes,omitempty"`
-	Comments     []bson.ObjectId `bson:"comments" json:"comments,omitempty"`
-	IsDraft      bool            `bson:"isdraft" json:"isdraft"`
-	IsSuspended  bool            `bson:"issuspended" json:"issuspended"`
-	SuspendNote  string          `bson:",omitempty" json:"suspend_note"`
-	Suspended    time.Time       `bson:",omitempty" json:"-"`
-	IsDeleted    bool            `bson:"isdeleted" json:"-"`
-	Deleted      time.Time       `bson:",omitempty" json:"-"`
-	Created      time.Time       `json:"created"`
+	Id            bson.ObjectId     `bson:"_id" json:"id"`
+	UserId        bson.ObjectId     `json:"userid,omitempty"`
+	PetId         bson.ObjectId     `json:"petid,omitempty" binding:"required"`
+	PetType       int               `json:"pet_type"`
+	PetAge        int               `json:"pet_age"`
+	PetSize       int               `json:"pet_size"`
+	HospitalId    bson.ObjectId     `bson:"hospitalid,omitempty" json:"hospitalid,omitempty"`
+	HospitalName  string            `bson:"hospital,omitempty" json:"hospital_name"`
+	Location      GeoJson           `bson:"location" json:"location,omitempty"`
+	LocationName  string            `bson:",omitempty" json:"location_name"`
+	Region        *Region           `bson:"region,omitempty" json:"region,omitempty"` // Of Location
+	VisitTime     time.Time         `bson:",omitempty" json:"visit_time,omitempty"`
+	Category      string            `bson:",omitempty" json:"category,omitempty"`
+	Categories    []string          `bson:",omitempty" json:"categories,omitempty"`
+	Parts         []string          `bson:",omitempty" json:"parts,omitempty"`
+	Cost          int               `bson:",omitempty" json:"cost"`
+	Rating        *Rating           `bson:"rating,omitempty" json:"rating,omitempty"`
+	ReviewBody    string            `json:"reviewbody" binding:"required"`
+	Images        []bson.ObjectId   `bson:"images" json:"images,omitempty"`
+	Likes         []bson.ObjectId   `bson:"likes" json:"-"`
+	LikeCount     int               `bson:"likecount" json:"like_count"`
+	Liked         bool              `bson:"-" json:"liked"` // Liked by who requested
+	BookmarkCount int               `bson:"bookmarkcount" json:"bookmark_count"`
+	Comments      []bson.ObjectId   `bson:"comments" json:"comments,omitempty"`
+	Response      *OfficialResponse `bson:"response,omitempty" json:"response,omitempty"` // By the hospital
+	IsDraft       bool              `bson:"isdraft" json:"isdraft"`
+	IsAnonymous   bool              `bson:"isanonymous" json:"isanonymous"` // Author is hidden to others
+	IsEdited      bool              `bson:"isedited" json:"isedited"`
+	Edited        time.Time         `bson:",omitempty" json:"edited,omitempty"`
+	Updated       time.Time         `bson:",omitempty" json:"updated,omitempty"` // Last saved as draft
+	IsPending     bool              `bson:"ispending" json:"ispending"`          // Held for moderation as likely spam
+	SpamScore     float64           `bson:",omitempty" json:"-"`
+	SpamReasons   []string          `bson:",omitempty" json:"-"`
+	IP            string            `bson:",omitempty" json:"-"`
+	IsSuspended   bool              `bson:"issuspended" json:"issuspended"`
+	SuspendNote   string            `bson:",omitempty" json:"suspend_note"`
+	Suspended     time.Time         `bson:",omitempty" json:"-"`
+	IsDeleted     bool              `bson:"isdeleted" json:"-"`
+	Deleted       time.Time         `bson:",omitempty" json:"-"`
+	SearchTerms   string            `bson:"searchterms" json:"-"`
+	ShareSlug     string            `bson:"shareslug,omitempty" json:"-"` // Public link when shared
+	Created       time.Time         `json:"created"`
 }
 
 ////////////////////////      BASIC OPERATIONS     ///////////////////////////
 
 func (i *Review) Like(userId bson.ObjectId) (alreadyLiked bool, err error) {
-	if err := i.GetById(i.Id); err != nil {
+	alreadyLiked, i.LikeCount, err = addLike(dbcReviews, i.Id, userId)
+	if err != nil {
+		log.Println("Erro while liking review.")
 		return false, err
 	}
 
-	n, err := dbcReviews.Find(bson.M{"_id": i.Id, "likes": bson.M{"$in": []bson.ObjectId{userId}}}).Count()
+	i.Liked = true
+	return alreadyLiked, nil
+}
+
+func (i *Review) Unlike(userId bson.ObjectId) (notLiked bool, err error) {
+	notLiked, i.LikeCount, err = removeLike(dbcReviews, i.Id, userId)
 	if err != nil {
+		log.Println("Erro while unliking review.")
 		return false, err
 	}
 
-	if n > 0 {
-		return true, nil
-	}
+	i.Liked = false
+	return notLiked, nil
+}
 
-	i.Likes = append(i.Likes, userId)
-	_, err = i.Update()
+// SetViewer prepares the review for the user who requested it. It sets Liked
+// and hides the author of an anonymous review from others.
+func (i *Review) SetViewer(userId bson.ObjectId) {
+	i.Liked = isLikedBy(i.Likes, userId)
 
-	if err != nil {
-		log.Println("Erro while liking review.")
-		return false, err
+	if i.IsAnonymous && i.UserId != userId {
+		i.UserId = ""
+		i.PetId = ""
+	}
+}
+
+func setReviewsViewer(reviews []Review, userId bson.ObjectId) {
+	for n := range reviews {
+		reviews[n].SetViewer(userId)
 	}
-	return false, err
 }
 
 func (i *Review) AddComment(commentId bson.ObjectId) (err error) {
-	if err := i.GetById(i.Id); err != nil {
-		return err
+	if err = dbcReviews.UpdateId(i.Id, bson.M{"$addToSet": bson.M{"comments": commentId}}); err != nil {
+		log.Println("Could not add a comment to the review.")
+		return
 	}
 
 	i.Comments = append(i.Comments, commentId)
-	_, err = i.Update()
+	return
+}
 
-	if err != nil {
-		log.Println("Added a comment to the review.")
-		return
+func (i *Review) RemoveComment(commentId bson.ObjectId) (err error) {
+	if err = dbcReviews.UpdateId(i.Id, bson.M{"$pull": bson.M{"comments": commentId}}); err != nil {
+		log.Println("Could not remove a comment from the review.")
 	}
 	return
 }
 
+// clearPosted zeroes fields of a posted review that only the server sets.
+func (i *Review) clearPosted() {
+	i.Id = ""
+	i.Likes = nil
+	i.LikeCount = 0
+	i.BookmarkCount = 0
+	i.Comments = nil
+	i.Response = nil
+	i.IsEdited = false
+	i.Edited = time.Time{}
+	i.IsPending = false
+	i.IsSuspended = false
+	i.SuspendNote = ""
+	i.Region = nil
+}
+
 func (i *Review) Insert() (newId bson.ObjectId, err error) {
 	if i.Id.Valid() == false {
 		i.Id = bson.NewObjectId()
@@ -129,12 +253,18 @@ func (i *Review) Insert() (newId bson.ObjectId, err error) {
 
 	i.Created = time.Now()
 	i.IsDeleted = false
+	i.SearchTerms = i.searchTerms()
+	i.setRegion()
 
 	if err = dbcReviews.Insert(&i); err != nil {
 		log.Println("Could not insert a review.")
 		return i.Id, err
 	}
 
+	if i.IsDraft == false {
+		updateHospitalRatings(i.HospitalId)
+	}
+
 	return i.Id, nil
 }
 
@@ -144,10 +274,27 @@ func (i *Review) Update() (changeInfo *mgo.ChangeInfo, err error) {
 		return
 	}
 
+	i.SearchTerms = i.searchTerms()
+	i.setRegion()
 	changeInfo, err = dbcReviews.UpsertId(i.Id, &i)
 	return
 }
 
+// Fields of reviews set from ReviewContent. Images are pushed on upload, so
+// they are saved only when posted.
+var reviewContentFields = []string{
+	"reviewbody", "hospitalid", "hospital", "location", "locationname", "region", "visittime",
+	"categories", "parts", "cost", "rating", "isanonymous", "searchterms", "updated",
+}
+
+// saveContent saves the content of the review and fields, leaving likes,
+// bookmarks and comments as they are in DB.
+func (i *Review) saveContent(fields ...string) error {
+	i.SearchTerms = i.searchTerms()
+	i.setRegion()
+	return setFields(dbcReviews, i.Id, i, append(reviewContentFields, fields...)...)
+}
+
 func (i *Review) DeleteSoft() (err error) {
 	if i.Id.Valid() == false {
 		err = errors.New("Invalid Review Id")
@@ -156,7 +303,11 @@ func (i *Review) DeleteSoft() (err error) {
 	i.IsDeleted = true
 	i.Deleted = time.Now()
 
-	_, err = i.Update()
+	if err = setFields(dbcReviews, i.Id, i, "isdeleted", "deleted"); err != nil {
+		return
+	}
+
+	updateHospitalRatings(i.HospitalId)
 	return
 }
 
@@ -179,6 +330,34 @@ func (i *Review) GetById(id bson.ObjectId) (err error) {
 	return
 }
 
+func (i *Review) searchTerms() string {
+	return searchTerms(
+		i.ReviewBody,
+		i.HospitalName,
+		i.LocationName,
+		strings.Join(i.Categories, " "),
+		strings.Join(i.Parts, " "),
+	)
+}
+
+// SortValue returns the value of the field key is on. Used for cursors.
+func (i *Review) SortValue(key SortKey) interface{} {
+	switch key.Field {
+	case "likecount":
+		return i.LikeCount
+	case "cost":
+		return i.Cost
+	case "visittime":
+		return i.VisitTime
+	case "rating.overall":
+		if i.Rating != nil {
+			return i.Rating.Overall
+		}
+		return 0
+	}
+	return i.Created
+}
+
 /////////////////////////    CONTROLLERS   ///////////////////////////
 
 func getReviewCount(gc *gin.Context) {
@@ -192,7 +371,7 @@ func getReviewCount(gc *gin.Context) {
 
 func getReview(gc *gin.Context) {
 	//DumpRequestBody(gc)
-	loggedIn, _ := isLoggedIn(gc)
+	loggedIn, myAccount := isLoggedIn(gc)
 	if loggedIn == false {
 		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Not Logged In."})
 		return
@@ -215,12 +394,16 @@ func getReview(gc *gin.Context) {
 		return
 	}
 
-	if review.IsDeleted || review.IsDraft {
+	isMyDraft := review.IsDraft && review.UserId == myAccount.Id
+	if review.IsDeleted || (review.IsDraft && isMyDraft == false) {
 		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Not Found ."})
 		return
 	} else if review.IsSuspended {
 		gc.JSON(http.StatusOK, gin.H{"status": -2, "message": "Suspended."})
 		return
+	} else if review.IsPending && review.UserId != myAccount.Id {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Not Found ."})
+		return
 	}
 
 	pet := Pet{
@@ -232,91 +415,100 @@ func getReview(gc *gin.Context) {
 		return
 	}
 
-	gc.JSON(http.StatusOK, gin.H{
+	review.SetViewer(myAccount.Id)
+	markFeedRead(myAccount.Id, &review)
+
+	response := gin.H{
 		"status":  0,
 		"message": "Successfully fetched Review.",
 		"review":  review,
-		"pet":     pet,
-	})
+	}
+
+	// The pet would tell who the anonymous author is.
+	if review.UserId.Valid() {
+		response["pet"] = pet
+	}
+
+	// Only the author sees the share link.
+	if review.UserId == myAccount.Id && review.ShareSlug != "" {
+		response["share_url"] = shareUrl(gc, review.ShareSlug)
+	}
+
+	gc.JSON(http.StatusOK, response)
 	return
 }
 
 func getReviews(gc *gin.Context) {
 	DumpRequestBody(gc)
-	loggedIn, _ := isLoggedIn(gc)
+	loggedIn, myAccount := isLoggedIn(gc)
 	if loggedIn == false {
 		return
 	}
 
-	sort := gc.DefaultQuery("sort", "-created")
-
-	skipStr := gc.DefaultQuery("skip", "0")
-	limitStr := gc.DefaultQuery("limit", "20")
-	skip, err := strconv.Atoi(skipStr)
-	if err != nil {
-		skip = 0
-	}
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		limit = 20
-	}
-
-	var reviews []Review
-	if err := dbcReviews.Find(bson.M{"isdraft": false, "isdeleted": false}).Sort(sort).Skip(skip).Limit(limit).All(&reviews); err != nil {
-		log.Print(err)
-		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error get data from DB."})
-		return
-	}
-
-	if len(reviews) == 0 {
-		log.Print("No Reviews")
-		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No reviews."})
+	rq := NewReviewQuery()
+	if err := rq.Parse(gc); err != nil {
 		return
 	}
 
-	log.Println("Fetched " + strconv.Itoa(len(reviews)) + " rows.")
-	gc.JSON(http.StatusOK, gin.H{
-		"status":  0,
-		"message": "Successfully fetched Reviews.",
-		"reviews": reviews,
-	})
-
-	/*
-		if devMode {
-			if buf, err := json.MarshalIndent(reviews, "", "  "); err == nil {
-				log.Print(string(buf))
-			}
-		}
-	*/
-
-	return
+	listReviews(gc, rq, DefaultPageLimit, myAccount.Id)
 }
 
 type TempId struct {
 	Id bson.ObjectId `bson:"_id"`
 }
 
-func getReviewsByLocation(gc *gin.Context) {
-	DumpRequestBody(gc)
-	loggedIn, _ := isLoggedIn(gc)
-	if loggedIn == false {
+// ReviewNearby is a Review with its distance in meters from the queried point.
+type ReviewNearby struct {
+	Review   `bson:",inline"`
+	Distance float64 `bson:"distance" json:"distance"`
+}
+
+// SetDistance sets Distance from near.
+func (i *ReviewNearby) SetDistance(near NearRequest) {
+	if len(i.Location.Coordinates) < 2 {
 		return
 	}
+	i.Distance = distanceMeters(near.Latitude, near.Longitude, i.Location.Coordinates[1], i.Location.Coordinates[0])
+}
 
-	//DumpRequestBody(gc)
-
-	sort := gc.DefaultQuery("sort", "-created")
-	log.Print(sort)
+// $geoNear returns at most 100 documents unless limit is given.
+const geoNearLimit = 1000
+
+// reviewsNearPipeline sorts reviews matching query by distance from posted
+// location, up to posted.Distance meters, and returns the page after the
+// cursor.
+func reviewsNearPipeline(posted NearRequest, page Page, query bson.M) []bson.M {
+	geoNear := bson.M{
+		"near": bson.M{
+			"type":        "Point",
+			"coordinates": []float64{posted.Longitude, posted.Latitude},
+		},
+		"distanceField": "distance",
+		"spherical":     true,
+		"query":         query,
+		"limit":         geoNearLimit,
+	}
+	if posted.Distance > 0 {
+		geoNear["maxDistance"] = posted.Distance
+	}
 
-	skipStr := gc.DefaultQuery("skip", "0")
-	limitStr := gc.DefaultQuery("limit", "100")
-	skip, err := strconv.Atoi(skipStr)
-	if err != nil {
-		skip = 0
+	pipeline := []bson.M{{"$geoNear": geoNear}}
+	if page.HasCursor {
+		geoNear["minDistance"] = page.Cursor.Number
+		pipeline = append(pipeline, bson.M{"$match": page.DistanceMatch()})
 	}
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		limit = 100
+
+	return append(pipeline,
+		bson.M{"$sort": bson.D{{Name: "distance", Value: 1}, {Name: "_id", Value: 1}}},
+		bson.M{"$limit": page.QueryLimit()},
+	)
+}
+
+func getReviewsByLocation(gc *gin.Context) {
+	DumpRequestBody(gc)
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
 	}
 
 	var posted NearRequest
@@ -330,184 +522,41 @@ func getReviewsByLocation(gc *gin.Context) {
 	}
 
 	locationStr := fmt.Sprintf("Lat %f Long: %f Dist: %f.", posted.Latitude, posted.Longitude, posted.Distance)
-	//log.Printf("Posted lat %f long: %f dist: %f.", posted.Latitude, posted.Longitude, posted.Distance)
 	log.Print(locationStr)
 
-	// var nearbyHospitalIds []TempId
-	//
-	// if err := dbcHospitals.Find(bson.M{
-	// 	"location": bson.M{
-	// 		"$nearSphere": bson.M{
-	// 			"$geometry": bson.M{
-	// 				"type":        "Point",
-	// 				"coordinates": []float64{posted.Longitude, posted.Latitude},
-	// 			},
-	// 			"$maxDistance": int(posted.Distance),
-	// 		},
-	// 	},
-	// }).Limit(200).Select(bson.M{"_id": true}).All(&nearbyHospitalIds); err != nil {
-	// 	log.Print(err)
-	// 	gc.JSON(http.StatusOK, gin.H{
-	// 		"status":  -1,
-	// 		"message": "Could not find hospitals from the location provided.",
-	// 	})
-	// 	return
-	// }
-	//
-	// //log.Print("Hospital " + nearbyHospitalIds[0].Id.Hex())
-	//
-	// var array []bson.ObjectId
-	// array = make([]bson.ObjectId, len(nearbyHospitalIds))
-	// for i, v := range nearbyHospitalIds {
-	// 	array[i] = v.Id
-	// }
-
-	var reviews []Review
-	if err := dbcReviews.Find(bson.M{
-		"location": bson.M{
-			"$nearSphere": bson.M{
-				"$geometry": bson.M{
-					"type":        "Point",
-					"coordinates": []float64{posted.Longitude, posted.Latitude},
-				},
-				//"$maxDistance": int(posted.Distance),
-			},
-		},
-		"isdraft":     false,
-		"isdeleted":   false,
-		"issuspended": false,
-		//"hospitalid": bson.M{"$in": array},
-	}).Skip(skip).Limit(limit).All(&reviews); err != nil {
-		log.Print(err)
-		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error get data from DB."})
+	rq := NewReviewQuery()
+	rq.SetNear(posted)
+	if err := rq.Parse(gc); err != nil {
 		return
 	}
 
-	status := 0
-
-	if len(reviews) == 0 {
-		log.Print("No Reviews found in that location")
-
-		if err := dbcReviews.Find(bson.M{
-			"location": bson.M{
-				"$nearSphere": bson.M{
-					"$geometry": bson.M{
-						"type":        "Point",
-						"coordinates": []float64{posted.Longitude, posted.Latitude},
-					},
-				},
-			},
-			"isdraft":     false,
-			"isdeleted":   false,
-			"issuspended": false,
-			//"hospitalid": bson.M{"$in": array},
-		}).Skip(skip).Limit(limit).All(&reviews); err != nil {
-			log.Print(err)
-			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error get data from DB."})
-			return
-		}
-
-		if len(reviews) == 0 {
-			gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No reviews."})
-			return
-		}
-		status = 2
-	}
-
-	log.Println("Fetched " + strconv.Itoa(len(reviews)) + " rows.")
-	gc.JSON(http.StatusOK, gin.H{
-		"status":  status,
-		"message": "Successfully fetched Reviews.",
-		"reviews": reviews,
-	})
-
-	/*
-		if devMode {
-			if buf, err := json.MarshalIndent(reviews, "", "  "); err == nil {
-				log.Print(string(buf))
-			}
-		}
-	*/
-
-	return
+	listReviews(gc, rq, MaxPageLimit, myAccount.Id)
 }
 
 func getReviewsByCategory(gc *gin.Context) {
 	DumpRequestBody(gc)
-	loggedIn, _ := isLoggedIn(gc)
+	loggedIn, myAccount := isLoggedIn(gc)
 	if loggedIn == false {
 		return
 	}
 
-	sort := gc.DefaultQuery("sort", "-created")
-	skipStr := gc.DefaultQuery("skip", "0")
-	limitStr := gc.DefaultQuery("limit", "100")
-	skip, err := strconv.Atoi(skipStr)
-	if err != nil {
-		skip = 0
-	}
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		limit = 100
-	}
-
-	//category := gc.Param("category")
-	categories := gc.Param("categories")
-	categoriesArray := strings.Split(categories, ",")
-
-	var reviews []Review
-	if err := dbcReviews.Find(bson.M{
-		"isdraft":    false,
-		"isdeleted":  false,
-		"categories": bson.M{"$in": categoriesArray},
-	}).Sort(sort).Skip(skip).Limit(limit).All(&reviews); err != nil {
-		log.Print(err)
-		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error get data from DB."})
-		return
-	}
-
-	if len(reviews) == 0 {
-		log.Print("No Reviews")
-		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No reviews."})
+	rq := NewReviewQuery()
+	if err := rq.Parse(gc); err != nil {
 		return
 	}
 
-	log.Println("Fetched " + strconv.Itoa(len(reviews)) + " rows.")
-	gc.JSON(http.StatusOK, gin.H{
-		"status":  0,
-		"message": "Successfully fetched Reviews.",
-		"reviews": reviews,
-	})
-
-	/*
-		if devMode {
-			if buf, err := json.MarshalIndent(reviews, "", "  "); err == nil {
-				log.Print(string(buf))
-			}
-		}
-	*/
+	categories := gc.Param("categories")
+	rq.Categories(strings.Split(categories, ","))
 
-	return
+	listReviews(gc, rq, DefaultPageLimit, myAccount.Id)
 }
 
 func getReviewsByPet(gc *gin.Context) {
-	loggedIn, _ := isLoggedIn(gc)
+	loggedIn, myAccount := isLoggedIn(gc)
 	if loggedIn == false {
 		return
 	}
 
-	sort := gc.DefaultQuery("sort", "-created")
-	skipStr := gc.DefaultQuery("skip", "0")
-	limitStr := gc.DefaultQuery("limit", "20")
-	skip, err := strconv.Atoi(skipStr)
-	if err != nil {
-		skip = 0
-	}
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		limit = 20
-	}
-
 	var posted Pet
 	if err := gc.Bind(&posted); err != nil {
 		log.Print(err)
@@ -518,41 +567,16 @@ func getReviewsByPet(gc *gin.Context) {
 		return
 	}
 
-	var reviews []Review
-	if err := dbcReviews.Find(bson.M{
-		"isdraft":   false,
-		"isdeleted": false,
-		"pettype":   posted.Type,
-		"petage":    posted.Age,
-		"petsize":   posted.Size,
-	}).Sort(sort).Skip(skip).Limit(limit).All(&reviews); err != nil {
-		log.Print(err)
-		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error get data from DB."})
-		return
-	}
-
-	if len(reviews) == 0 {
-		log.Print("No Reviews")
-		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No reviews."})
+	rq := NewReviewQuery()
+	if err := rq.Parse(gc); err != nil {
 		return
 	}
 
-	log.Println("Fetched " + strconv.Itoa(len(reviews)) + " rows.")
-	gc.JSON(http.StatusOK, gin.H{
-		"status":  0,
-		"message": "Successfully fetched Reviews.",
-		"reviews": reviews,
-	})
-
-	/*
-		if devMode {
-			if buf, err := json.MarshalIndent(reviews, "", "  "); err == nil {
-				log.Print(string(buf))
-			}
-		}
-	*/
+	rq.PetType(posted.Type)
+	rq.PetSizes([]int{posted.Size})
+	rq.Filter["petage"] = posted.Age
 
-	return
+	listReviews(gc, rq, DefaultPageLimit, myAccount.Id)
 }
 
 func getMyReviews(gc *gin.Context) {
@@ -561,43 +585,17 @@ func getMyReviews(gc *gin.Context) {
 		return
 	}
 
-	sort := gc.DefaultQuery("sort", "-created")
-	skipStr := gc.DefaultQuery("skip", "0")
-	limitStr := gc.DefaultQuery("limit", "100")
-	skip, err := strconv.Atoi(skipStr)
-	if err != nil {
-		skip = 0
-	}
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		limit = 100
-	}
-
-	var reviews []Review
-	if err := dbcReviews.Find(bson.M{
-		"userid":    myAccount.Id,
-		"isdraft":   false,
-		"isdeleted": false,
-	}).Sort(sort).Skip(skip).Limit(limit).All(&reviews); err != nil {
-		log.Print(err)
-		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error while retrieving data from DB."})
+	rq := NewReviewQuery()
+	if err := rq.Parse(gc); err != nil {
 		return
 	}
 
-	if len(reviews) == 0 {
-		gc.JSON(http.StatusOK, gin.H{
-			"status":  1,
-			"message": "No Reviews.",
-		})
-		return
-	}
+	// Suspended and pending reviews are still listed to the owner.
+	delete(rq.Filter, "issuspended")
+	delete(rq.Filter, "ispending")
+	rq.User(myAccount.Id)
 
-	log.Println("Fetched " + strconv.Itoa(len(reviews)) + " rows.")
-	gc.JSON(http.StatusOK, gin.H{
-		"status":  0,
-		"message": "Successfully fetched My Reviews.",
-		"reviews": reviews,
-	})
+	listReviews(gc, rq, DefaultPageLimit, myAccount.Id)
 }
 
 func insertReview(gc *gin.Context) {
@@ -612,6 +610,7 @@ func insertReview(gc *gin.Context) {
 		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Parsing posted JSON failed."})
 		return
 	}
+	posted.clearPosted()
 
 	pet := Pet{}
 	if err := dbcPets.FindId(posted.PetId).One(&pet); err != nil {
@@ -630,6 +629,7 @@ func insertReview(gc *gin.Context) {
 	posted.UserId = myAccount.Id
 
 	if posted.HospitalId.Valid() == true {
+		posted.HospitalId = resolveHospitalId(posted.HospitalId)
 		var hospital Hospital
 		if err := dbcHospitals.FindId(posted.HospitalId).One(&hospital); err != nil {
 			log.Print(err)
@@ -639,16 +639,42 @@ func insertReview(gc *gin.Context) {
 
 	// TODO Filter User Input
 
+	if err := validateLocation(posted.Location); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	if err := posted.Rating.Validate(); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	if posted.IsDraft == false {
+		if _, err := posted.CheckSpam(remoteIP(gc)); err == ErrTooManyReviews {
+			gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+			return
+		} else if err != nil {
+			log.Println(err)
+			DatabaseError(gc)
+			return
+		}
+	}
+
 	if _, err := posted.Insert(); err != nil {
 		log.Println(err)
 		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Failed to insert review to DB."})
 		return
 	}
 
+	if posted.IsDraft == false && posted.IsPending == false {
+		go notifyFollowers(posted)
+	}
+
 	gc.JSON(http.StatusOK, gin.H{
-		"status":  0,
-		"message": "Uploaded review!",
-		"newid":   posted.Id.Hex(),
+		"status":    0,
+		"message":   "Uploaded review!",
+		"newid":     posted.Id.Hex(),
+		"ispending": posted.IsPending,
 	})
 }
 
@@ -682,9 +708,38 @@ func updateReview(gc *gin.Context) {
 		return
 	}
 
+	if item.IsDeleted {
+		gc.JSON(http.StatusOK, gin.H{
+			"status":  -1,
+			"message": "No Reviews Found!",
+		})
+		return
+	}
+
+	var posted ReviewContent
+	if err := gc.BindJSON(&posted); err != nil {
+		log.Println(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Parsing posted JSON failed."})
+		return
+	}
+
+	if err := posted.Validate(&item); err != nil {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": err.Error()})
+		return
+	}
+
+	if err := item.Edit(myAccount.Id, posted); err != nil {
+		log.Println(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Failed to update review."})
+		return
+	}
+
+	item.SetViewer(myAccount.Id)
+
 	gc.JSON(http.StatusOK, gin.H{
-		"status":  -1,
-		"message": "Not Yet Implemented.",
+		"status":  0,
+		"message": "Updated review!",
+		"review":  item,
 	})
 }
 
@@ -770,13 +825,13 @@ func likeReview(gc *gin.Context) {
 
 	} else {
 		if alreadyLiked == true {
-			gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Your already liked it!"})
+			gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Your already liked it!", "like_count": review.LikeCount})
 			return
 		}
 	}
 
 	if myAccount.Id == review.UserId {
-		gc.JSON(http.StatusOK, gin.H{"status": 2, "message": "You liked your own review!"})
+		gc.JSON(http.StatusOK, gin.H{"status": 2, "message": "You liked your own review!", "like_count": review.LikeCount})
 		return
 	}
 
@@ -801,6 +856,35 @@ func likeReview(gc *gin.Context) {
 		log.Print(err)
 	}
 
-	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Liked the review!"})
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Liked the review!", "like_count": review.LikeCount})
 	return
 }
+
+func unlikeReview(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	reviewId, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	review := Review{Id: reviewId}
+	if notLiked, err := review.Unlike(myAccount.Id); err == mgo.ErrNotFound {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "No Review found matching ObjectId."})
+		return
+
+	} else if err != nil {
+		log.Println(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error while updating DB!"})
+		return
+
+	} else if notLiked == true {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "You have not liked it.", "like_count": review.LikeCount})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Unliked the review.", "like_count": review.LikeCount})
+}
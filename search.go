@@ -0,0 +1,422 @@
+package main
+
+import (
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Korean words get particles attached ("슬개골이", "슬개골을") and MongoDB has
+// no analyzer for it. Hangul is indexed as character bigrams instead, so
+// "슬개골" matches "슬개골이" by its grams "슬개" and "개골". Other words are
+// indexed lowercased as they are.
+//
+// Grams are stored space separated in "searchterms" of each document which has
+// a text index with language "none".
+
+func init() {
+	backfillSearchTerms()
+}
+
+// searchTextIndex is the text index on searchterms of a collection.
+var searchTextIndex = mgo.Index{
+	Key:             []string{"$text:searchterms"},
+	DefaultLanguage: "none",
+	Background:      true,
+}
+
+func isHangul(r rune) bool {
+	return unicode.Is(unicode.Hangul, r)
+}
+
+// splitWords splits text into words. Hangul and other letters are split
+// into separate words, so "MRI검사" is "mri" and "검사".
+func splitWords(text string) [][]rune {
+	var words [][]rune
+	var word []rune
+	wordIsHangul := false
+
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) == false && unicode.IsDigit(r) == false {
+			if len(word) > 0 {
+				words = append(words, word)
+				word = nil
+			}
+			continue
+		}
+
+		if len(word) > 0 && isHangul(r) != wordIsHangul {
+			words = append(words, word)
+			word = nil
+		}
+		word = append(word, r)
+		wordIsHangul = isHangul(r)
+	}
+
+	if len(word) > 0 {
+		words = append(words, word)
+	}
+	return words
+}
+
+// searchGrams returns the terms to index or search for texts.
+func searchGrams(texts ...string) []string {
+	var grams []string
+	seen := make(map[string]bool)
+	add := func(gram string) {
+		if seen[gram] == false {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+
+	for _, text := range texts {
+		for _, word := range splitWords(text) {
+			if isHangul(word[0]) == false || len(word) == 1 {
+				add(string(word))
+				continue
+			}
+
+			for i := 0; i+1 < len(word); i++ {
+				add(string(word[i : i+2]))
+			}
+		}
+	}
+
+	return grams
+}
+
+func searchTerms(texts ...string) string {
+	return strings.Join(searchGrams(texts...), " ")
+}
+
+// highlight returns a snippet of text around the first match of query.
+// Matches are wrapped in <em></em> and the text is escaped as HTML.
+func highlight(text string, query string) (snippet string, matched bool) {
+	const before = 20
+	const length = 80
+
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		lower = runes
+	}
+
+	terms := searchGrams(query)
+	for _, word := range splitWords(query) {
+		terms = append(terms, string(word))
+	}
+
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		t := []rune(term)
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) != term {
+				continue
+			}
+			for j := i; j < i+len(t); j++ {
+				marked[j] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+
+	matched = first != -1
+	if matched == false {
+		first = 0
+	}
+
+	start := first - before
+	if start < 0 {
+		start = 0
+	}
+	end := start + length
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var buf []rune
+	if start > 0 {
+		buf = append(buf, []rune("...")...)
+	}
+	for i := start; i < end; i++ {
+		if marked[i] && (i == start || marked[i-1] == false) {
+			buf = append(buf, []rune("<em>")...)
+		}
+		buf = append(buf, []rune(html.EscapeString(string(runes[i])))...)
+		if marked[i] && (i+1 == end || marked[i+1] == false) {
+			buf = append(buf, []rune("</em>")...)
+		}
+	}
+	if end < len(runes) {
+		buf = append(buf, []rune("...")...)
+	}
+
+	return string(buf), matched
+}
+
+// searchPipeline matches terms and returns the page after the cursor ordered
+// by relevance. Each result has the document in "doc" and its "score".
+// Stages filter matches further before they are paged.
+func searchPipeline(terms string, filter bson.M, page Page, stages ...bson.M) []bson.M {
+	match := bson.M{"$text": bson.M{"$search": terms}}
+	for k, v := range filter {
+		match[k] = v
+	}
+
+	pipeline := append([]bson.M{{"$match": match}}, stages...)
+	pipeline = append(pipeline, bson.M{"$project": bson.M{"doc": "$$ROOT", "score": bson.M{"$meta": "textScore"}}})
+
+	if page.HasCursor {
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"$or": []bson.M{
+			{"score": bson.M{"$lt": page.Cursor.Number}},
+			{"score": page.Cursor.Number, "_id": bson.M{"$lt": page.Cursor.Id}},
+		}}})
+	}
+
+	return append(pipeline,
+		bson.M{"$sort": bson.D{{Name: "score", Value: -1}, {Name: "_id", Value: -1}}},
+		bson.M{"$limit": page.QueryLimit()},
+	)
+}
+
+// getSearchRequest reads "q" and the page from query string.
+// Responds on its own when invalid.
+func getSearchRequest(gc *gin.Context) (q string, terms string, page Page, ok bool) {
+	q = strings.TrimSpace(gc.Query("q"))
+	terms = searchTerms(q)
+	if terms == "" {
+		MissingRequiredValue(gc, "q")
+		return q, terms, page, false
+	}
+
+	page, err := getPageFromQuery(gc, DefaultPageLimit, SortKey{Field: "score"}, true)
+	if err != nil {
+		return q, terms, page, false
+	}
+
+	log.Printf("Search q: %s terms: %s", q, terms)
+	return q, terms, page, true
+}
+
+func searchResponse(gc *gin.Context, results []gin.H, nextCursor string, hasMore bool) {
+	if len(results) == 0 {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "No results.", "has_more": false})
+		return
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(results)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully searched.",
+		"results":     results,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
+}
+
+////////////////////////     BACKFILL     ///////////////////////////
+
+// backfillSearchTerms indexes documents saved before searchterms existed.
+func backfillSearchTerms() {
+	notIndexed := bson.M{"searchterms": bson.M{"$exists": false}}
+
+	var review Review
+	iter := dbcReviews.Find(notIndexed).Iter()
+	for iter.Next(&review) {
+		dbcReviews.UpdateId(review.Id, bson.M{"$set": bson.M{"searchterms": review.searchTerms()}})
+	}
+	if err := iter.Close(); err != nil {
+		log.Print(err)
+	}
+
+	var hospital Hospital
+	iter = dbcHospitals.Find(notIndexed).Iter()
+	for iter.Next(&hospital) {
+		dbcHospitals.UpdateId(hospital.Id, bson.M{"$set": bson.M{"searchterms": hospital.searchTerms()}})
+	}
+	if err := iter.Close(); err != nil {
+		log.Print(err)
+	}
+
+	var comment Comment
+	iter = dbcComments.Find(notIndexed).Iter()
+	for iter.Next(&comment) {
+		dbcComments.UpdateId(comment.Id, bson.M{"$set": bson.M{"searchterms": comment.searchTerms()}})
+	}
+	if err := iter.Close(); err != nil {
+		log.Print(err)
+	}
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+func searchReviews(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	q, terms, page, ok := getSearchRequest(gc)
+	if ok == false {
+		return
+	}
+
+	var found []struct {
+		Review Review  `bson:"doc"`
+		Score  float64 `bson:"score"`
+	}
+	if err := dbcReviews.Pipe(searchPipeline(terms, bson.M{
+		"isdraft":     false,
+		"isdeleted":   false,
+		"issuspended": false,
+		"ispending":   bson.M{"$ne": true},
+	}, page)).All(&found); err != nil {
+		log.Print(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error get data from DB."})
+		return
+	}
+
+	hasMore := page.HasMore(len(found))
+	nextCursor := ""
+	if hasMore {
+		found = found[:page.Limit]
+		last := found[len(found)-1]
+		nextCursor = NewCursor(last.Score, last.Review.Id).Encode()
+	}
+
+	results := make([]gin.H, 0, len(found))
+	for _, item := range found {
+		item.Review.SetViewer(myAccount.Id)
+		snippet, matched := highlight(item.Review.ReviewBody, q)
+		if matched == false {
+			if name, ok := highlight(item.Review.HospitalName, q); ok {
+				snippet = name
+			}
+		}
+		results = append(results, gin.H{
+			"review":    item.Review,
+			"highlight": snippet,
+			"score":     item.Score,
+		})
+	}
+
+	searchResponse(gc, results, nextCursor, hasMore)
+}
+
+func searchHospitals(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	q, terms, page, ok := getSearchRequest(gc)
+	if ok == false {
+		return
+	}
+
+	var found []struct {
+		Hospital Hospital `bson:"doc"`
+		Score    float64  `bson:"score"`
+	}
+	if err := dbcHospitals.Pipe(searchPipeline(terms, bson.M{"mergedinto": bson.M{"$exists": false}}, page)).All(&found); err != nil {
+		log.Print(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error get data from DB."})
+		return
+	}
+
+	hasMore := page.HasMore(len(found))
+	nextCursor := ""
+	if hasMore {
+		found = found[:page.Limit]
+		last := found[len(found)-1]
+		nextCursor = NewCursor(last.Score, last.Hospital.Id).Encode()
+	}
+
+	now := time.Now()
+	results := make([]gin.H, 0, len(found))
+	for _, item := range found {
+		item.Hospital.SetLiked(myAccount.Id)
+		item.Hospital.SetOpenStatus(now)
+		name, _ := highlight(item.Hospital.Name, q)
+		address, _ := highlight(item.Hospital.Address, q)
+		results = append(results, gin.H{
+			"hospital":          item.Hospital,
+			"highlight":         name,
+			"highlight_address": address,
+			"score":             item.Score,
+		})
+	}
+
+	searchResponse(gc, results, nextCursor, hasMore)
+}
+
+func searchComments(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	q, terms, page, ok := getSearchRequest(gc)
+	if ok == false {
+		return
+	}
+
+	var found []struct {
+		Comment Comment `bson:"doc"`
+		Score   float64 `bson:"score"`
+	}
+	// Comments of reviews hidden to others are left out.
+	if err := dbcComments.Pipe(searchPipeline(terms, bson.M{"category": "review"}, page,
+		bson.M{"$lookup": bson.M{
+			"from":         TableNameReviews,
+			"localField":   "relatedid",
+			"foreignField": "_id",
+			"as":           "review",
+		}},
+		bson.M{"$match": bson.M{"review": bson.M{"$elemMatch": bson.M{
+			"isdraft":     false,
+			"isdeleted":   false,
+			"issuspended": false,
+			"ispending":   bson.M{"$ne": true},
+		}}}},
+		bson.M{"$project": bson.M{"review": 0}},
+	)).All(&found); err != nil {
+		log.Print(err)
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Error get data from DB."})
+		return
+	}
+
+	hasMore := page.HasMore(len(found))
+	nextCursor := ""
+	if hasMore {
+		found = found[:page.Limit]
+		last := found[len(found)-1]
+		nextCursor = NewCursor(last.Score, last.Comment.Id).Encode()
+	}
+
+	results := make([]gin.H, 0, len(found))
+	for _, item := range found {
+		item.Comment.SetViewer(myAccount.Id)
+		snippet, _ := highlight(item.Comment.CommentBody, q)
+		results = append(results, gin.H{
+			"comment":   item.Comment,
+			"reviewid":  item.Comment.RelatedId,
+			"highlight": snippet,
+			"score":     item.Score,
+		})
+	}
+
+	searchResponse(gc, results, nextCursor, hasMore)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Reviews are shared to people without the app by a link to /share/:slug.
+// Slugs are random, so shared reviews cannot be found by guessing.
+
+const shareTemplate = "share_review.html"
+
+func newShareSlug() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func shareUrl(gc *gin.Context, slug string) string {
+	return "https://" + gc.Request.Host + "/share/" + slug
+}
+
+// Share creates a share link of the review unless it has one.
+func (i *Review) Share() (err error) {
+	if i.ShareSlug != "" {
+		return nil
+	}
+
+	slug, err := newShareSlug()
+	if err != nil {
+		return
+	}
+
+	if err = dbcReviews.UpdateId(i.Id, bson.M{"$set": bson.M{"shareslug": slug}}); err != nil {
+		return
+	}
+
+	i.ShareSlug = slug
+	return nil
+}
+
+// Unshare revokes the share link of the review.
+func (i *Review) Unshare() (err error) {
+	if err = dbcReviews.UpdateId(i.Id, bson.M{"$unset": bson.M{"shareslug": ""}}); err != nil {
+		return
+	}
+
+	i.ShareSlug = ""
+	return nil
+}
+
+func petTypeName(petType int) string {
+	switch petType {
+	case PetDog:
+		return "강아지"
+	case PetCat:
+		return "고양이"
+	}
+	return "기타"
+}
+
+// getMySharedReview finds the review of id owned by userId. Responds on its
+// own when not found.
+func getMySharedReview(gc *gin.Context, userId bson.ObjectId) (review Review, ok bool) {
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return review, false
+	}
+
+	if err := review.GetById(id); err != nil || review.IsDeleted {
+		DataNotFound(gc)
+		return review, false
+	}
+
+	if review.UserId != userId {
+		NotAuthorized(gc)
+		return review, false
+	}
+
+	return review, true
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+func shareReview(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	review, ok := getMySharedReview(gc, myAccount.Id)
+	if ok == false {
+		return
+	}
+
+	if review.IsDraft || review.IsSuspended || review.IsPending {
+		gc.JSON(http.StatusOK, gin.H{"status": -1, "message": "Cannot share this review."})
+		return
+	}
+
+	if err := review.Share(); err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":  0,
+		"message": "Shared review.",
+		"slug":    review.ShareSlug,
+		"url":     shareUrl(gc, review.ShareSlug),
+	})
+}
+
+func unshareReview(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	review, ok := getMySharedReview(gc, myAccount.Id)
+	if ok == false {
+		return
+	}
+
+	if err := review.Unshare(); err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Revoked share link."})
+}
+
+// getSharedReview renders the shared review as a public HTML page.
+func getSharedReview(gc *gin.Context) {
+	slug := gc.Param("slug")
+
+	var review Review
+	if err := dbcReviews.Find(bson.M{"shareslug": slug}).One(&review); err != nil ||
+		slug == "" || review.IsDeleted || review.IsSuspended || review.IsDraft || review.IsPending {
+		gc.HTML(http.StatusNotFound, shareTemplate, gin.H{"Found": false})
+		return
+	}
+
+	var images []Image
+	if len(review.Images) > 0 {
+		if err := dbcImages.Find(bson.M{"_id": bson.M{"$in": review.Images}}).Sort("created").All(&images); err != nil {
+			log.Print(err)
+		}
+	}
+
+	base := "https://" + gc.Request.Host
+	imageUrls := make([]string, 0, len(images))
+	for _, image := range images {
+		imageUrls = append(imageUrls, base+"/img/"+image.Filename)
+	}
+
+	hospitalName := review.HospitalName
+	if hospitalName == "" {
+		hospitalName = "동물병원"
+	}
+
+	rating := 0
+	if review.Rating != nil {
+		rating = review.Rating.Overall
+	}
+
+	gc.HTML(http.StatusOK, shareTemplate, gin.H{
+		"Found":        true,
+		"Title":        hospitalName + " 리뷰",
+		"Description":  snippet(review.ReviewBody, snippetLength),
+		"Url":          shareUrl(gc, slug),
+		"HospitalName": hospitalName,
+		"PetType":      petTypeName(review.PetType),
+		"Rating":       rating,
+		"Body":         review.ReviewBody,
+		"ImageUrls":    imageUrls,
+		"Created":      review.Created.Format("2006-01-02"),
+	})
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math/bits"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Reviews are scored for spam before they are published. A review scoring
+// spamThreshold or more is pending until an admin approves it.
+//
+// Near-duplicates are found by simhash of 3-rune shingles of the body. Two
+// bodies whose hashes differ in simhashDistance bits or less are the same
+// text with small changes.
+
+const (
+	spamThreshold   = 1.0
+	simhashDistance = 3
+	shingleLength   = 3
+
+	spamRecentLimit = 20 // Recent reviews compared with a new one
+	newAccountAge   = 24 * time.Hour
+
+	// Reviews per hour. More are rejected.
+	maxReviewsPerHour           = 5
+	maxReviewsPerHourNewAccount = 1
+	maxReviewsPerHourIP         = 10
+)
+
+var ErrTooManyReviews = errors.New("Too many reviews. Try again later.")
+
+var (
+	linkPattern  = regexp.MustCompile(`(?i)(https?://|www\.|[a-z0-9-]+\.(com|net|kr|co|me|ly)\b)`)
+	phonePattern = regexp.MustCompile(`0\d{1,2}[-.\s]?\d{3,4}[-.\s]?\d{4}`)
+)
+
+// Spam signals and their scores.
+var spamScores = map[string]float64{
+	"duplicate_own":      1.0, // Same as a recent review of the author
+	"duplicate_hospital": 0.8, // Same as a recent review of the hospital by another
+	"rate_user":          0.5, // Many reviews of the author in the last hour
+	"rate_ip":            0.5, // Many reviews from the IP in the last hour
+	"link":               0.6,
+	"phone":              0.6,
+	"new_account":        0.3,
+}
+
+func fnv64(s string) uint64 {
+	const offset = 14695981039346656037
+	const prime = 1099511628211
+
+	hash := uint64(offset)
+	for i := 0; i < len(s); i++ {
+		hash ^= uint64(s[i])
+		hash *= prime
+	}
+	return hash
+}
+
+// simhash returns the 64 bit simhash of text. Similar texts have hashes
+// differing in a few bits.
+func simhash(text string) uint64 {
+	var runes []rune
+	for _, word := range splitWords(text) {
+		runes = append(runes, word...)
+	}
+
+	var weights [64]int
+	for i := 0; i+shingleLength <= len(runes) || (i == 0 && len(runes) > 0); i++ {
+		end := i + shingleLength
+		if end > len(runes) {
+			end = len(runes)
+		}
+
+		hash := fnv64(string(runes[i:end]))
+		for bit := uint(0); bit < 64; bit++ {
+			if hash&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var hash uint64
+	for bit := uint(0); bit < 64; bit++ {
+		if weights[bit] > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash
+}
+
+func isNearDuplicate(a, b uint64) bool {
+	return bits.OnesCount64(a^b) <= simhashDistance
+}
+
+// SpamCheck scores a review about to be published.
+type SpamCheck struct {
+	Score   float64
+	Reasons []string
+}
+
+func (c *SpamCheck) add(reason string) {
+	c.Score += spamScores[reason]
+	c.Reasons = append(c.Reasons, reason)
+}
+
+func (c *SpamCheck) IsSpam() bool {
+	return c.Score >= spamThreshold
+}
+
+func recentReviewsSince(query bson.M, since time.Time) (int, error) {
+	query["created"] = bson.M{"$gte": since}
+	return dbcReviews.Find(query).Count()
+}
+
+// hasNearDuplicate tells if a recent review matching query has body like hash.
+func hasNearDuplicate(query bson.M, hash uint64) bool {
+	var recent []Review
+	if err := dbcReviews.Find(query).Select(bson.M{"reviewbody": 1}).Sort("-created").Limit(spamRecentLimit).All(&recent); err != nil {
+		log.Print(err)
+		return false
+	}
+
+	for _, review := range recent {
+		if isNearDuplicate(hash, simhash(review.ReviewBody)) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the address the request came from. The server is not
+// behind a proxy, so X-Forwarded-For is not trusted as by gc.ClientIP.
+func remoteIP(gc *gin.Context) string {
+	ip, _, err := net.SplitHostPort(gc.Request.RemoteAddr)
+	if err != nil {
+		return gc.Request.RemoteAddr
+	}
+	return ip
+}
+
+// CheckSpam scores the review posted from ip, and sets it pending when it
+// looks like spam. Returns ErrTooManyReviews when the author or ip posts too
+// many reviews.
+func (i *Review) CheckSpam(ip string) (check SpamCheck, err error) {
+	var author User
+	if err = author.GetById(i.UserId); err != nil {
+		return
+	}
+
+	hourAgo := time.Now().Add(-time.Hour)
+
+	// Drafts being published are not compared with themselves.
+	published := bson.M{"isdraft": false}
+	if i.Id.Valid() {
+		published["_id"] = bson.M{"$ne": i.Id}
+	}
+	withPublished := func(query bson.M) bson.M {
+		for k, v := range published {
+			query[k] = v
+		}
+		return query
+	}
+
+	limit := maxReviewsPerHour
+	if time.Since(author.Created) < newAccountAge {
+		limit = maxReviewsPerHourNewAccount
+		check.add("new_account")
+	}
+
+	n, err := recentReviewsSince(withPublished(bson.M{"userid": i.UserId}), hourAgo)
+	if err != nil {
+		return
+	}
+	if n >= limit {
+		return check, ErrTooManyReviews
+	}
+	if n >= 2 {
+		check.add("rate_user")
+	}
+
+	if ip != "" {
+		n, err = recentReviewsSince(withPublished(bson.M{"ip": ip}), hourAgo)
+		if err != nil {
+			return
+		}
+		if n >= maxReviewsPerHourIP {
+			return check, ErrTooManyReviews
+		}
+		if n >= maxReviewsPerHourIP/2 {
+			check.add("rate_ip")
+		}
+	}
+
+	hash := simhash(i.ReviewBody)
+	published["isdeleted"] = false
+
+	if hasNearDuplicate(withPublished(bson.M{"userid": i.UserId}), hash) {
+		check.add("duplicate_own")
+	}
+
+	if i.HospitalId.Valid() {
+		others := withPublished(bson.M{"hospitalid": i.HospitalId, "userid": bson.M{"$ne": i.UserId}})
+		if hasNearDuplicate(others, hash) {
+			check.add("duplicate_hospital")
+		}
+	}
+
+	if linkPattern.MatchString(i.ReviewBody) {
+		check.add("link")
+	}
+	if phonePattern.MatchString(strings.Replace(i.ReviewBody, " ", "", -1)) {
+		check.add("phone")
+	}
+
+	i.IP = ip
+	i.IsPending = check.IsSpam()
+	i.SpamScore = check.Score
+	i.SpamReasons = check.Reasons
+	return check, nil
+}
+
+// Approve publishes the pending review.
+func (i *Review) Approve() (err error) {
+	i.IsPending = false
+	if err = setFields(dbcReviews, i.Id, i, "ispending"); err != nil {
+		return
+	}
+
+	updateHospitalRatings(i.HospitalId)
+	return nil
+}
+
+/////////////////////////    CONTROLLERS   ///////////////////////////
+
+// getPendingReviews lists reviews waiting for moderation to admins.
+func getPendingReviews(gc *gin.Context) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	page, err := getPageFromQuery(gc, DefaultPageLimit, SortKeyCreated, false)
+	if err != nil {
+		return
+	}
+
+	var reviews []Review
+	query := page.Query(bson.M{"ispending": true, "isdeleted": false})
+	if err := dbcReviews.Find(query).Sort(page.Sort()...).Limit(page.QueryLimit()).All(&reviews); err != nil {
+		log.Print(err)
+		DatabaseError(gc)
+		return
+	}
+
+	reviews, nextCursor, hasMore := pageReviews(reviews, page)
+
+	results := make([]gin.H, 0, len(reviews))
+	for _, review := range reviews {
+		results = append(results, gin.H{
+			"review":       review,
+			"userid":       review.UserId,
+			"spam_score":   review.SpamScore,
+			"spam_reasons": review.SpamReasons,
+		})
+	}
+
+	log.Println("Fetched " + strconv.Itoa(len(results)) + " rows.")
+	gc.JSON(http.StatusOK, gin.H{
+		"status":      0,
+		"message":     "Successfully fetched Pending Reviews.",
+		"reviews":     results,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
+}
+
+// moderateReview approves or rejects a pending review. Rejected reviews are
+// suspended with the posted note.
+func moderateReview(gc *gin.Context, approve bool) {
+	loggedIn, myAccount := isLoggedIn(gc)
+	if loggedIn == false {
+		return
+	}
+
+	if isAdmin(myAccount) == false {
+		NotAuthorized(gc)
+		return
+	}
+
+	id, err := getIdFromParam(gc)
+	if err != nil {
+		return
+	}
+
+	var review Review
+	if err := review.GetById(id); err != nil || review.IsDeleted {
+		DataNotFound(gc)
+		return
+	}
+
+	if review.IsPending == false {
+		gc.JSON(http.StatusOK, gin.H{"status": 1, "message": "Not pending."})
+		return
+	}
+
+	if approve {
+		if err := review.Approve(); err != nil {
+			log.Println(err)
+			DatabaseError(gc)
+			return
+		}
+
+		go notifyFollowers(review)
+		gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Approved review."})
+		return
+	}
+
+	review.IsPending = false
+	review.IsSuspended = true
+	review.Suspended = time.Now()
+	review.SuspendNote = gc.PostForm("note")
+	if review.SuspendNote == "" {
+		review.SuspendNote = "Spam"
+	}
+
+	if err := setFields(dbcReviews, review.Id, &review, "ispending", "issuspended", "suspended", "suspendnote"); err != nil {
+		log.Println(err)
+		DatabaseError(gc)
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Rejected review."})
+}
+
+func approveReview(gc *gin.Context) {
+	moderateReview(gc, true)
+}
+
+func rejectReview(gc *gin.Context) {
+	moderateReview(gc, false)
+}
@@ -47,6 +47,7 @@ func init() {
 
 const UserGroupTemp = 0
 const UserGroupNormal = 100
+const UserGroupStaff = 1000 // Verified staff of a hospital
 const UserGroupAdmin = 10000
 
 type User struct {
@@ -71,9 +72,10 @@ type UserData struct {
 	UserId         bson.ObjectId `bson:"_id" json:"-"`
 	Nickname       string        `bson:",omitempty" json:"nickname" form:"nickname"`
 	ProfileImageId bson.ObjectId `bson:",omitempty" json:"imageid,omitempty"`
+	FollowerCount  int           `bson:"followercount" json:"follower_count"`
+	FollowingCount int           `bson:"followingcount" json:"following_count"`
 	Updated        time.Time     `json:"updated,omitempty"`
 	//MyHospitalId        bson.ObjectId   `bson:",omitempty" json:"myhospitalid"`
-	//FavoriteHospitalIds []bson.ObjectId `bson:",omitempty" json:"favorite_hospitals"`
 	//HomeLocation        GeoJson         `bson:",omitempty" json:"home_location"`
 	//HomeAddress         string          `bson:",omitempty" json:"home_address"`
 }
@@ -163,16 +165,19 @@ func (i *UserData) GetById(id bson.ObjectId) (err error) {
 	return
 }
 
+// Upsert saves the nickname of the user, leaving follower counts as they
+// are in DB.
 func (i *UserData) Upsert() (changeInfo *mgo.ChangeInfo, err error) {
 	if i.UserId.Valid() == false {
 		log.Println("Cannot upsert userdata without proper userid")
 		return
 	}
 	i.Updated = time.Now()
-	if changeInfo, err := dbcUserData.UpsertId(i.UserId, &i); err != nil {
-		return changeInfo, err
+	set := bson.M{"updated": i.Updated}
+	if i.Nickname != "" {
+		set["nickname"] = i.Nickname
 	}
-	return changeInfo, err
+	return dbcUserData.UpsertId(i.UserId, bson.M{"$set": set})
 }
 
 ///////////////////    ADDITIONAL   /////////////////////
@@ -436,7 +441,8 @@ func login(gc *gin.Context) {
 }
 
 func getUser(gc *gin.Context) {
-	if isLoggedIn, _ := isLoggedIn(gc); isLoggedIn == false {
+	isLoggedIn, myAccount := isLoggedIn(gc)
+	if isLoggedIn == false {
 		return
 	}
 
@@ -453,7 +459,19 @@ func getUser(gc *gin.Context) {
 		return
 	}
 
-	gc.JSON(http.StatusOK, gin.H{"status": 0, "message": "Success.", "user": i})
+	var userData UserData
+	if err := userData.GetById(i.Id); err != nil {
+		log.Println(err)
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"status":          0,
+		"message":         "Success.",
+		"user":            i,
+		"follower_count":  userData.FollowerCount,
+		"following_count": userData.FollowingCount,
+		"followed":        isFollowing(myAccount.Id, "user", i.Id),
+	})
 	return
 }
 